@@ -1,14 +1,35 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+
 	"github.com/eugene-static/wishlist_bot/app/internal/server"
 	"github.com/eugene-static/wishlist_bot/app/lib/config"
 )
 
 func main() {
-	cfg, err := config.Get("app/internal/config/config.json")
+	path := flag.String("config", config.DefaultPath,
+		"path to the config file, empty to take the whole config from "+config.EnvPrefix+"_* environment variables")
+	flag.Parse()
+	cfg, err := config.Get(*path)
 	if err != nil {
-		panic(err)
+		exit(err)
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err = migrate(cfg, args[1:]); err != nil {
+			exit(err)
+		}
+		return
+	}
+	if err = cfg.Validate(); err != nil {
+		exit(fmt.Errorf("invalid config:\n%w", err))
 	}
 	server.New(cfg).Start()
 }
+
+func exit(err error) {
+	os.Stderr.WriteString(err.Error() + "\n")
+	os.Exit(1)
+}
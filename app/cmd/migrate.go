@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/storage"
+	"github.com/eugene-static/wishlist_bot/app/lib/config"
+)
+
+const migrateUsage = "usage: migrate [up|status]"
+
+func migrate(cfg *config.Config, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if len(args) > 1 {
+		return errors.New(migrateUsage)
+	}
+	ctx := context.Background()
+	db, err := storage.Open(&cfg.Storage)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := storage.NewMigrator(db, cfg.Storage.Driver)
+	if err != nil {
+		return err
+	}
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "status":
+		current, err := migrator.Current(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("current version: %d\nlatest version: %d\n", current, migrator.Latest())
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range pending {
+			fmt.Printf("pending %04d_%s\n", m.Version, m.Name)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
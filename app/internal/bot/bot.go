@@ -1,41 +1,129 @@
 package bot
 
-import tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+import (
+	"errors"
+	"strings"
+
+	"github.com/eugene-static/wishlist_bot/app/lib/i18n"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
 
 const ModeHTML = tgbotapi.ModeHTML
 
+// MaxMessageLength is the limit Telegram puts on the length of a message.
+const MaxMessageLength = 4096
+
+type (
+	Button = tgbotapi.InlineKeyboardButton
+	Markup = tgbotapi.InlineKeyboardMarkup
+)
+
 type Sender interface {
-	Send(int, int64, string) (int, error)
+	Send(int64, string, int, string) (int, error)
 }
 
 type Bot struct {
 	Config *Config
 	bot    *tgbotapi.BotAPI
+	outbox *Outbox
 }
 
 func NewBot(bot *tgbotapi.BotAPI) *Bot {
 	return &Bot{
 		Config: &Config{
-			config:       map[int]tgbotapi.MessageConfig{},
-			replyMessage: make(map[int]string),
+			config:  map[int]tgbotapi.MessageConfig{},
+			catalog: i18n.New(""),
 		},
 		bot: bot,
 	}
 }
 
-func (b *Bot) Send(id int64, configKey int, messageKey int) (int, error) {
-	c := b.Config.get(configKey, messageKey)
+// UseOutbox makes every request to Telegram go through o.
+func (b *Bot) UseOutbox(o *Outbox) {
+	b.outbox = o
+}
+
+func (b *Bot) do(chatID int64, limited bool, send func() error) error {
+	if b.outbox == nil {
+		return send()
+	}
+	return b.outbox.do(chatID, limited, send)
+}
+
+func (b *Bot) Username() string {
+	return b.bot.Self.UserName
+}
+
+// Reply is a single outgoing message. Level selects the preconfigured message
+// settings and keyboard, Markup replaces that keyboard when set. Lang is the
+// language of the keyboard labels.
+type Reply struct {
+	Level  int
+	Lang   string
+	Text   string
+	Markup *Markup
+}
+
+func (b *Bot) Send(id int64, lang string, configKey int, messageKey string) (int, error) {
+	return b.Reply(id, Reply{Level: configKey, Lang: lang, Text: b.Config.Text(lang, messageKey)})
+}
+
+func (b *Bot) Reply(id int64, r Reply) (int, error) {
+	c := b.Config.get(r.Lang, r.Level)
 	c.ChatID = id
-	m, err := b.bot.Send(c)
+	c.Text = r.Text
+	if r.Markup != nil {
+		c.ReplyMarkup = *r.Markup
+	}
+	var m tgbotapi.Message
+	err := b.do(id, true, func() (err error) {
+		m, err = b.bot.Send(c)
+		return err
+	})
 	if err != nil {
 		return -1, err
 	}
 	return m.MessageID, nil
 }
 
+// Edit replaces the text and keyboard of the message sent earlier. Editing a
+// message to the same content is not an error.
+func (b *Bot) Edit(id int64, messageID int, r Reply) error {
+	c := b.Config.get(r.Lang, r.Level)
+	e := tgbotapi.NewEditMessageText(id, messageID, r.Text)
+	e.ParseMode = c.ParseMode
+	e.DisableWebPagePreview = c.DisableWebPagePreview
+	if r.Markup != nil {
+		e.ReplyMarkup = r.Markup
+	} else if markup, ok := c.ReplyMarkup.(Markup); ok {
+		e.ReplyMarkup = &markup
+	}
+	err := b.do(id, true, func() error {
+		_, err := b.bot.Request(e)
+		return err
+	})
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.Message, "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+// Answer stops the loading animation on the button the user pressed,
+// showing text as a toast unless it is empty.
+func (b *Bot) Answer(callbackID string, text string) error {
+	return b.do(0, false, func() error {
+		_, err := b.bot.Request(tgbotapi.NewCallback(callbackID, text))
+		return err
+	})
+}
+
+// Config holds message settings and texts. It is filled once on startup and
+// only read afterwards, so it is safe for concurrent use by handlers.
+// Button labels of the keyboards are text keys translated on sending.
 type Config struct {
-	config       map[int]tgbotapi.MessageConfig
-	replyMessage map[int]string
+	config  map[int]tgbotapi.MessageConfig
+	catalog *i18n.Catalog
 }
 
 func NewConfig(parseMode string) tgbotapi.MessageConfig {
@@ -53,23 +141,56 @@ func (c *Config) Set(key int, cfg tgbotapi.MessageConfig) {
 	c.config[key] = cfg
 }
 
-func (c *Config) SetReplyMessage(key int, message string) {
-	c.replyMessage[key] = message
+func (c *Config) UseCatalog(catalog *i18n.Catalog) {
+	c.catalog = catalog
 }
 
-func (c *Config) get(configKey int, messageKey int) tgbotapi.MessageConfig {
-	if cfg, ok := c.config[configKey]; ok {
-		cfg.Text = c.getReplyMessage(messageKey)
-		return cfg
+func (c *Config) get(lang string, configKey int) tgbotapi.MessageConfig {
+	cfg, ok := c.config[configKey]
+	if !ok {
+		return tgbotapi.MessageConfig{}
+	}
+	if _, ok = cfg.ReplyMarkup.(Markup); ok {
+		cfg.ReplyMarkup = c.Markup(lang, configKey)
 	}
-	return tgbotapi.MessageConfig{}
+	return cfg
 }
 
-func (c *Config) getReplyMessage(key int) string {
-	if m, ok := c.replyMessage[key]; ok {
-		return m
+// Markup returns the keyboard of the message settings under key with the
+// labels in lang.
+func (c *Config) Markup(lang string, key int) Markup {
+	markup, _ := c.config[key].ReplyMarkup.(Markup)
+	rows := make([][]Button, len(markup.InlineKeyboard))
+	for i, row := range markup.InlineKeyboard {
+		rows[i] = make([]Button, len(row))
+		for j, button := range row {
+			button.Text = c.Text(lang, button.Text)
+			rows[i][j] = button
+		}
 	}
-	return "Невозможно обработать запрос"
+	markup.InlineKeyboard = rows
+	return markup
+}
+
+func (c *Config) Languages() []string {
+	return c.catalog.Languages()
+}
+
+// Language returns the supported language for a Telegram language code.
+func (c *Config) Language(code string) string {
+	return c.catalog.Match(code)
+}
+
+func (c *Config) Text(lang string, key string) string {
+	return c.catalog.Text(lang, key, nil)
+}
+
+func (c *Config) Render(lang string, key string, args i18n.Args) string {
+	return c.catalog.Text(lang, key, args)
+}
+
+func (c *Config) Plural(lang string, key string, n int, args i18n.Args) string {
+	return c.catalog.Plural(lang, key, n, args)
 }
 
 func NewButton(name string, data string) tgbotapi.InlineKeyboardButton {
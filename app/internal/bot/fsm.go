@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var (
+	ErrUnknownState = errors.New("unknown state")
+	ErrTransition   = errors.New("transition is not allowed")
+)
+
+// StateStore keeps the conversation state of the user the request in ctx belongs to.
+type StateStore interface {
+	State(ctx context.Context) (name string, since time.Time)
+	SetState(ctx context.Context, name string)
+}
+
+type State struct {
+	// Prompt is sent every time the conversation enters the state.
+	Prompt HandlerFunc
+	// Validate checks the input before Handle. If it fails, the conversation
+	// stays in the state and Invalid is called instead.
+	Validate func(ctx context.Context, r *Request) error
+	Invalid  func(ctx context.Context, r *Request, err error)
+	Handle   HandlerFunc
+	// Next lists the states Handle is allowed to transition to.
+	Next []string
+	// Timeout limits how long the state waits for input. Late input finishes
+	// the conversation and is passed to Expired.
+	Timeout time.Duration
+	Expired HandlerFunc
+}
+
+// FSM routes plain text messages to the state the conversation is in.
+// Messages outside of a conversation are passed to fallback.
+type FSM struct {
+	store    StateStore
+	states   map[string]State
+	fallback HandlerFunc
+}
+
+func NewFSM(store StateStore, fallback HandlerFunc) *FSM {
+	return &FSM{
+		store:    store,
+		states:   make(map[string]State),
+		fallback: fallback,
+	}
+}
+
+func (f *FSM) Handle(name string, state State) {
+	f.states[name] = state
+}
+
+// Enter starts a conversation in the named state regardless of the current one.
+func (f *FSM) Enter(ctx context.Context, r *Request, name string) error {
+	state, ok := f.states[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownState, name)
+	}
+	f.store.SetState(ctx, name)
+	if state.Prompt != nil {
+		state.Prompt(ctx, r)
+	}
+	return nil
+}
+
+// Transition moves the conversation to one of the states listed in Next of the current one.
+func (f *FSM) Transition(ctx context.Context, r *Request, to string) error {
+	from, _ := f.store.State(ctx)
+	if !slices.Contains(f.states[from].Next, to) {
+		return fmt.Errorf("%w: %q -> %q", ErrTransition, from, to)
+	}
+	return f.Enter(ctx, r, to)
+}
+
+func (f *FSM) Finish(ctx context.Context) {
+	f.store.SetState(ctx, "")
+}
+
+func (f *FSM) ServeBot(ctx context.Context, r *Request) {
+	name, since := f.store.State(ctx)
+	state, ok := f.states[name]
+	if !ok {
+		f.fallback(ctx, r)
+		return
+	}
+	if state.Timeout > 0 && time.Since(since) > state.Timeout {
+		f.Finish(ctx)
+		if state.Expired != nil {
+			state.Expired(ctx, r)
+		} else {
+			f.fallback(ctx, r)
+		}
+		return
+	}
+	if state.Validate != nil {
+		if err := state.Validate(ctx, r); err != nil {
+			if state.Invalid != nil {
+				state.Invalid(ctx, r, err)
+			}
+			return
+		}
+	}
+	state.Handle(ctx, r)
+}
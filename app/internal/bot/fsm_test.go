@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// stateStore keeps the state of a single conversation.
+type stateStore struct {
+	name  string
+	since time.Time
+}
+
+func (s *stateStore) State(context.Context) (string, time.Time) {
+	return s.name, s.since
+}
+
+func (s *stateStore) SetState(_ context.Context, name string) {
+	s.name, s.since = name, time.Now()
+}
+
+// calls records which handlers a request reached.
+type calls []string
+
+func (c *calls) handler(name string) HandlerFunc {
+	return func(context.Context, *Request) {
+		*c = append(*c, name)
+	}
+}
+
+func (c *calls) expect(t *testing.T, want ...string) {
+	t.Helper()
+	if !slices.Equal(*c, want) {
+		t.Fatalf("called %v, want %v", *c, want)
+	}
+	*c = nil
+}
+
+func newTestFSM() (*FSM, *stateStore, *calls) {
+	store := &stateStore{}
+	c := &calls{}
+	f := NewFSM(store, c.handler("fallback"))
+	f.Handle("name", State{
+		Prompt: c.handler("name prompt"),
+		Validate: func(_ context.Context, r *Request) error {
+			if r.Data == "" {
+				return errors.New("empty")
+			}
+			return nil
+		},
+		Invalid: func(context.Context, *Request, error) { *c = append(*c, "name invalid") },
+		Handle:  c.handler("name"),
+		Next:    []string{"price"},
+		Timeout: time.Minute,
+		Expired: c.handler("name expired"),
+	})
+	f.Handle("price", State{
+		Handle:  c.handler("price"),
+		Timeout: time.Minute,
+	})
+	return f, store, c
+}
+
+func TestFSMRoutesToState(t *testing.T) {
+	ctx := context.Background()
+	f, store, c := newTestFSM()
+	f.ServeBot(ctx, &Request{Data: "hello"})
+	c.expect(t, "fallback")
+
+	if err := f.Enter(ctx, &Request{}, "name"); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(t, "name prompt")
+	f.ServeBot(ctx, &Request{Data: ""})
+	c.expect(t, "name invalid")
+	if store.name != "name" {
+		t.Errorf("state after invalid input = %q, want name", store.name)
+	}
+	f.ServeBot(ctx, &Request{Data: "Tea"})
+	c.expect(t, "name")
+
+	f.Finish(ctx)
+	f.ServeBot(ctx, &Request{Data: "Tea"})
+	c.expect(t, "fallback")
+}
+
+func TestFSMTransition(t *testing.T) {
+	ctx := context.Background()
+	f, store, c := newTestFSM()
+	if err := f.Enter(ctx, &Request{}, "missing"); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("Enter() error = %v, want %v", err, ErrUnknownState)
+	}
+	_ = f.Enter(ctx, &Request{}, "name")
+	c.expect(t, "name prompt")
+	if err := f.Transition(ctx, &Request{}, "price"); err != nil {
+		t.Fatalf("Transition() error = %v", err)
+	}
+	if store.name != "price" {
+		t.Errorf("state = %q, want price", store.name)
+	}
+	if err := f.Transition(ctx, &Request{}, "name"); !errors.Is(err, ErrTransition) {
+		t.Errorf("Transition() error = %v, want %v", err, ErrTransition)
+	}
+	if store.name != "price" {
+		t.Errorf("state after a refused transition = %q, want price", store.name)
+	}
+}
+
+func TestFSMTimeout(t *testing.T) {
+	ctx := context.Background()
+	f, store, c := newTestFSM()
+
+	_ = f.Enter(ctx, &Request{}, "name")
+	c.expect(t, "name prompt")
+	store.since = time.Now().Add(-2 * time.Minute)
+	f.ServeBot(ctx, &Request{Data: "Tea"})
+	c.expect(t, "name expired")
+	if store.name != "" {
+		t.Errorf("state after timeout = %q, want none", store.name)
+	}
+
+	// Without Expired, late input goes to the fallback.
+	store.name, store.since = "price", time.Now().Add(-2*time.Minute)
+	f.ServeBot(ctx, &Request{Data: "100"})
+	c.expect(t, "fallback")
+	if store.name != "" {
+		t.Errorf("state after timeout = %q, want none", store.name)
+	}
+}
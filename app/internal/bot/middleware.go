@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/lib/lgr"
+)
+
+type loggerKey struct{}
+
+func WithLogger(ctx context.Context, log *lgr.Log) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+// Logger returns the request-scoped logger stored by Log or nil.
+func Logger(ctx context.Context) *lgr.Log {
+	log, _ := ctx.Value(loggerKey{}).(*lgr.Log)
+	return log
+}
+
+func logger(ctx context.Context, fallback *lgr.Log) *lgr.Log {
+	if log := Logger(ctx); log != nil {
+		return log
+	}
+	return fallback
+}
+
+// Log stores a logger with the attributes of the request in its context.
+func Log(log *lgr.Log) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, r *Request) {
+			log := log.With(
+				slog.Int64("user_id", r.Chat.ID),
+				slog.String("username", r.Chat.UserName),
+			)
+			next.ServeBot(WithLogger(ctx, log), r)
+		})
+	}
+}
+
+// Recover logs a panicking handler instead of crashing the bot.
+func Recover(log *lgr.Log) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, r *Request) {
+			defer func() {
+				if v := recover(); v != nil {
+					logger(ctx, log).Error("handler panic",
+						slog.Any("panic", v),
+						slog.String("stack", string(debug.Stack())),
+					)
+				}
+			}()
+			next.ServeBot(ctx, r)
+		})
+	}
+}
+
+// Timing logs how long the request took to handle and the route it took.
+// The data itself is not logged, as it may be a password.
+func Timing(log *lgr.Log) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, r *Request) {
+			start := time.Now()
+			next.ServeBot(ctx, r)
+			logger(ctx, log).Debug("request handled",
+				slog.String("route", r.Route),
+				slog.Duration("duration", time.Since(start)),
+			)
+		})
+	}
+}
+
+// RateLimit allows every chat at most burst requests at once, refilled at
+// limit requests per minute. Requests over the limit are passed to limited,
+// or dropped if it is nil.
+func RateLimit(log *lgr.Log, limit int, burst int, limited HandlerFunc) Middleware {
+	l := newLimiter(float64(limit)/time.Minute.Seconds(), burst)
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, r *Request) {
+			if l.allow(r.Chat.ID, time.Now()) {
+				next.ServeBot(ctx, r)
+				return
+			}
+			logger(ctx, log).Debug("request rate limited")
+			if limited != nil {
+				limited(ctx, r)
+			}
+		})
+	}
+}
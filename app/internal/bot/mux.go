@@ -2,6 +2,8 @@ package bot
 
 import (
 	"context"
+	"strings"
+	"unicode"
 )
 
 const DefaultMessage = "default"
@@ -16,8 +18,14 @@ func (hf HandlerFunc) ServeBot(ctx context.Context, r *Request) {
 	hf(ctx, r)
 }
 
+// Middleware wraps a handler to run code around it.
+type Middleware func(Handler) Handler
+
 type Mux struct {
-	m map[string]HandlerFunc
+	m          map[string]HandlerFunc
+	routes     []*route
+	keys       *KeyTable
+	middleware []Middleware
 }
 
 func NewBotMux() *Mux {
@@ -26,10 +34,36 @@ func NewBotMux() *Mux {
 	}
 }
 
+// Handle registers handler for pattern. Segments of the pattern in braces,
+// as in "wish/{id}/reserve", match any value and are passed in r.Params.
 func (m *Mux) Handle(pattern string, handler HandlerFunc) {
+	if isPattern(pattern) {
+		m.routes = append(m.routes, &route{pattern: pattern, segments: strings.Split(pattern, "/"), handler: handler})
+		return
+	}
 	m.m[pattern] = handler
 }
 
+// UseKeys makes Data store payloads too long for callback data in t.
+func (m *Mux) UseKeys(t *KeyTable) {
+	m.keys = t
+}
+
+// Data returns data suitable for the callback data of a button, replacing it
+// with a short key when it exceeds MaxCallbackData and a KeyTable is in use.
+func (m *Mux) Data(data string) string {
+	if len(data) <= MaxCallbackData || m.keys == nil {
+		return data
+	}
+	return m.keys.shorten(data)
+}
+
+// Use appends middleware to the chain every request passes through before
+// routing. The first middleware added is the outermost one.
+func (m *Mux) Use(middleware ...Middleware) {
+	m.middleware = append(m.middleware, middleware...)
+}
+
 func (m *Mux) Handler(pattern string) Handler {
 	if fn, ok := m.m[pattern]; ok {
 		return fn
@@ -38,9 +72,40 @@ func (m *Mux) Handler(pattern string) Handler {
 }
 
 func (m *Mux) ServeBot(ctx context.Context, r *Request) {
+	var h Handler = HandlerFunc(m.route)
+	for i := len(m.middleware) - 1; i >= 0; i-- {
+		h = m.middleware[i](h)
+	}
+	h.ServeBot(ctx, r)
+}
+
+func (m *Mux) route(ctx context.Context, r *Request) {
+	if m.keys != nil && strings.HasPrefix(r.Data, keyPrefix) {
+		if data, ok := m.keys.expand(r.Data); ok {
+			r.Data = data
+		}
+	}
+	r.Args, r.Params = "", nil
 	if f, ok := m.m[r.Data]; ok {
+		r.Route = r.Data
 		f(ctx, r)
-	} else {
-		m.m[DefaultMessage](ctx, r)
+		return
+	}
+	for _, rt := range m.routes {
+		if params, ok := rt.match(r.Data); ok {
+			r.Route, r.Params = rt.pattern, params
+			rt.handler(ctx, r)
+			return
+		}
+	}
+	// The arguments may start on the next line, as in a multi-line broadcast.
+	if i := strings.IndexFunc(r.Data, unicode.IsSpace); i > 0 && strings.HasPrefix(r.Data, "/") {
+		if f, ok := m.m[r.Data[:i]]; ok {
+			r.Route, r.Args = r.Data[:i], strings.TrimSpace(r.Data[i:])
+			f(ctx, r)
+			return
+		}
 	}
+	r.Route = DefaultMessage
+	m.m[DefaultMessage](ctx, r)
 }
@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/lib/lgr"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	DefaultSendRate     = 30
+	DefaultChatSendRate = 60
+	DefaultSendQueue    = 1000
+	DefaultSendRetries  = 3
+	chatSendBurst       = 3
+	retryBackoff        = 500 * time.Millisecond
+	maxRetryBackoff     = 10 * time.Second
+)
+
+var ErrQueueFull = errors.New("send queue is full")
+
+// Outbox paces outgoing requests to stay within the Telegram limits and
+// retries the ones Telegram asks to repeat.
+type Outbox struct {
+	// ctx ends the waits for the limits and retries, once it is done the
+	// messages still waiting are dropped.
+	ctx     context.Context
+	log     *lgr.Log
+	global  *limiter
+	chats   *limiter
+	size    int64
+	retries int
+	depth   atomic.Int64
+	sent    atomic.Uint64
+	retried atomic.Uint64
+	dropped atomic.Uint64
+}
+
+type OutboxStats struct {
+	Depth   int64
+	Sent    uint64
+	Retried uint64
+	Dropped uint64
+}
+
+// NewOutbox allows rate messages per second in total and chatRate messages
+// per minute to a single chat. At most queueSize requests wait for their turn,
+// the rest are dropped. Requests failing with 429, 5xx or a network error
+// are retried up to retries times. Messages still waiting when ctx is done
+// are dropped.
+func NewOutbox(ctx context.Context, log *lgr.Log, rate int, chatRate int, queueSize int, retries int) *Outbox {
+	if rate <= 0 {
+		rate = DefaultSendRate
+	}
+	if chatRate <= 0 {
+		chatRate = DefaultChatSendRate
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultSendQueue
+	}
+	if retries <= 0 {
+		retries = DefaultSendRetries
+	}
+	return &Outbox{
+		ctx:     ctx,
+		log:     log,
+		global:  newLimiter(float64(rate), rate),
+		chats:   newLimiter(float64(chatRate)/time.Minute.Seconds(), chatSendBurst),
+		size:    int64(queueSize),
+		retries: retries,
+	}
+}
+
+func (o *Outbox) Stats() OutboxStats {
+	return OutboxStats{
+		Depth:   o.depth.Load(),
+		Sent:    o.sent.Load(),
+		Retried: o.retried.Load(),
+		Dropped: o.dropped.Load(),
+	}
+}
+
+// do runs send once the limits allow it. Requests with limited set count
+// against the message limits of the chat, others are only retried.
+func (o *Outbox) do(chatID int64, limited bool, send func() error) error {
+	if o.depth.Add(1) > o.size {
+		o.depth.Add(-1)
+		return o.drop(chatID, ErrQueueFull)
+	}
+	defer o.depth.Add(-1)
+	for attempt := 0; ; attempt++ {
+		if limited {
+			if err := o.pace(chatID); err != nil {
+				return o.drop(chatID, err)
+			}
+		}
+		err := send()
+		if err == nil {
+			o.sent.Add(1)
+			return nil
+		}
+		delay, ok := retryDelay(err, attempt)
+		if !ok {
+			return err
+		}
+		if attempt >= o.retries {
+			return o.drop(chatID, err)
+		}
+		o.retried.Add(1)
+		o.log.Debug("retrying outgoing message", slog.Int64("user_id", chatID),
+			slog.Any("error", err), slog.Duration("delay", delay))
+		if err = o.sleep(delay); err != nil {
+			return o.drop(chatID, err)
+		}
+	}
+}
+
+func (o *Outbox) drop(chatID int64, err error) error {
+	o.dropped.Add(1)
+	o.log.Warn("dropping outgoing message", slog.Int64("user_id", chatID), slog.Any("error", err))
+	return err
+}
+
+// pace blocks until both the chat and the bot as a whole may send a message.
+func (o *Outbox) pace(chatID int64) error {
+	for d := o.chats.wait(chatID, time.Now()); d > 0; d = o.chats.wait(chatID, time.Now()) {
+		if err := o.sleep(d); err != nil {
+			return err
+		}
+	}
+	for d := o.global.wait(0, time.Now()); d > 0; d = o.global.wait(0, time.Now()) {
+		if err := o.sleep(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sleep waits for d unless the context of the outbox is done first.
+func (o *Outbox) sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-o.ctx.Done():
+		return o.ctx.Err()
+	}
+}
+
+// retryDelay reports whether err is worth retrying and after what delay:
+// Telegram tells how long to wait on 429, server and network errors back off
+// exponentially.
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	backoff := min(retryBackoff<<attempt, maxRetryBackoff)
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == http.StatusTooManyRequests:
+			if apiErr.RetryAfter > 0 {
+				return time.Duration(apiErr.RetryAfter) * time.Second, true
+			}
+			return retryBackoff, true
+		case apiErr.Code >= http.StatusInternalServerError:
+			return backoff, true
+		}
+		return 0, false
+	}
+	if transient(err) {
+		return backoff, true
+	}
+	return 0, false
+}
+
+// transient reports whether err is a network failure or a response that is
+// not JSON, as gateways in front of Telegram reply with 502 and 504 pages.
+func transient(err error) bool {
+	var (
+		netErr    net.Error
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	return errors.As(err, &netErr) ||
+		errors.As(err, &syntaxErr) ||
+		errors.As(err, &typeErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,220 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/lib/lgr"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		attempt int
+		delay   time.Duration
+		retry   bool
+	}{
+		{"retry after", &tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 3}}, 0, 3 * time.Second, true},
+		{"too many requests", &tgbotapi.Error{Code: 429}, 2, retryBackoff, true},
+		{"server error", &tgbotapi.Error{Code: 500}, 0, retryBackoff, true},
+		{"server error backoff", &tgbotapi.Error{Code: 502}, 2, 4 * retryBackoff, true},
+		{"backoff limit", &tgbotapi.Error{Code: 503}, 10, maxRetryBackoff, true},
+		{"bad request", &tgbotapi.Error{Code: 400}, 0, 0, false},
+		{"forbidden", &tgbotapi.Error{Code: 403}, 0, 0, false},
+		{"gateway page", &json.SyntaxError{}, 1, 2 * retryBackoff, true},
+		{"empty body", io.EOF, 0, retryBackoff, true},
+		{"connection reset", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, 0, retryBackoff, true},
+		{"other", errors.New("message text is empty"), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := retryDelay(tt.err, tt.attempt)
+			if delay != tt.delay || retry != tt.retry {
+				t.Errorf("retryDelay() = %v, %v, want %v, %v", delay, retry, tt.delay, tt.retry)
+			}
+		})
+	}
+}
+
+// flakyAPI answers sendMessage with the given responses in turn, then with
+// success.
+func flakyAPI(t *testing.T, responses ...http.HandlerFunc) (*tgbotapi.BotAPI, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bottoken/getMe" {
+			_, _ = io.WriteString(w, `{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot"}}`)
+			return
+		}
+		if n := int(calls.Add(1)); n <= len(responses) {
+			responses[n-1](w, r)
+			return
+		}
+		_, _ = io.WriteString(w, `{"ok":true,"result":{"message_id":1,"chat":{"id":1}}}`)
+	}))
+	t.Cleanup(srv.Close)
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", srv.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api, &calls
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`)
+}
+
+func badGateway(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusBadGateway)
+	_, _ = io.WriteString(w, "<html><body>502 Bad Gateway</body></html>")
+}
+
+func resetConnection(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		_ = conn.Close()
+	}
+}
+
+func badRequest(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`)
+}
+
+func send(api *tgbotapi.BotAPI) func() error {
+	return func() error {
+		_, err := api.Send(tgbotapi.NewMessage(1, "hi"))
+		return err
+	}
+}
+
+func TestOutboxRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []http.HandlerFunc
+		retries   int
+		calls     int32
+		wait      time.Duration
+		fail      bool
+		stats     OutboxStats
+	}{
+		{
+			name:      "retry after",
+			responses: []http.HandlerFunc{tooManyRequests},
+			retries:   3,
+			calls:     2,
+			wait:      time.Second,
+			stats:     OutboxStats{Sent: 1, Retried: 1},
+		},
+		{
+			name:      "gateway and network errors",
+			responses: []http.HandlerFunc{badGateway, resetConnection},
+			retries:   3,
+			calls:     3,
+			wait:      3 * retryBackoff,
+			stats:     OutboxStats{Sent: 1, Retried: 2},
+		},
+		{
+			name:      "retries exhausted",
+			responses: []http.HandlerFunc{badGateway, badGateway},
+			retries:   1,
+			calls:     2,
+			wait:      retryBackoff,
+			fail:      true,
+			stats:     OutboxStats{Retried: 1, Dropped: 1},
+		},
+		{
+			name:      "not retried",
+			responses: []http.HandlerFunc{badRequest},
+			retries:   3,
+			calls:     1,
+			fail:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			api, calls := flakyAPI(t, tt.responses...)
+			o := NewOutbox(context.Background(), lgr.New(io.Discard, ""), 0, 0, 0, tt.retries)
+			start := time.Now()
+			err := o.do(1, true, send(api))
+			if (err != nil) != tt.fail {
+				t.Fatalf("do() error = %v, want failure %v", err, tt.fail)
+			}
+			if elapsed := time.Since(start); elapsed < tt.wait {
+				t.Errorf("do() returned after %v, want at least %v", elapsed, tt.wait)
+			}
+			if n := calls.Load(); n != tt.calls {
+				t.Errorf("sent %d requests, want %d", n, tt.calls)
+			}
+			if stats := o.Stats(); stats != tt.stats {
+				t.Errorf("Stats() = %+v, want %+v", stats, tt.stats)
+			}
+		})
+	}
+}
+
+func TestOutboxCancel(t *testing.T) {
+	api, calls := flakyAPI(t, tooManyRequests)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	o := NewOutbox(ctx, lgr.New(io.Discard, ""), 0, 0, 0, 0)
+	if err := o.do(1, true, send(api)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("do() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestOutboxQueueFull(t *testing.T) {
+	o := NewOutbox(context.Background(), lgr.New(io.Discard, ""), 0, 0, 1, 0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		_ = o.do(1, false, func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	err := o.do(2, false, func() error { return nil })
+	close(release)
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("do() error = %v, want %v", err, ErrQueueFull)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(1, 2)
+	now := time.Now()
+	if !l.allow(1, now) || !l.allow(1, now) {
+		t.Fatal("burst is not allowed")
+	}
+	if l.allow(1, now) {
+		t.Fatal("request over the burst is allowed")
+	}
+	if !l.allow(2, now) {
+		t.Fatal("another chat is limited")
+	}
+	if d := l.wait(1, now.Add(500*time.Millisecond)); d != 500*time.Millisecond {
+		t.Errorf("wait() = %v, want %v", d, 500*time.Millisecond)
+	}
+	if !l.allow(1, now.Add(time.Second)) {
+		t.Error("token is not refilled")
+	}
+	l.sweep(now.Add(time.Hour))
+	if len(l.buckets) != 0 {
+		t.Errorf("%d buckets left after sweep, want 0", len(l.buckets))
+	}
+}
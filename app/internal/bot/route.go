@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/eugene-static/wishlist_bot/app/lib/random"
+)
+
+// MaxCallbackData is the limit Telegram puts on the callback data of a button.
+const MaxCallbackData = 64
+
+const (
+	DefaultKeyTableSize = 10000
+	keyPrefix           = "~"
+	keyLength           = 12
+)
+
+// route is a pattern like "wish/{id}/reserve" split into segments.
+type route struct {
+	pattern  string
+	segments []string
+	handler  HandlerFunc
+}
+
+func isPattern(pattern string) bool {
+	return strings.Contains(pattern, "{")
+}
+
+func param(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+func (rt *route) match(data string) (map[string]string, bool) {
+	parts := strings.Split(data, "/")
+	if len(parts) != len(rt.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, segment := range rt.segments {
+		if name, ok := param(segment); ok {
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[name] = parts[i]
+			continue
+		}
+		if segment != parts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// Fill substitutes values for the parameters of pattern in order:
+// Fill("list/{id}/page/{n}", id, "2") returns "list/<id>/page/2".
+func Fill(pattern string, values ...string) string {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if _, ok := param(segment); ok && len(values) > 0 {
+			segments[i], values = values[0], values[1:]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// KeyTable keeps callback data longer than MaxCallbackData on the server and
+// hands out short keys instead. It remembers the last size payloads only.
+type KeyTable struct {
+	mu    sync.Mutex
+	size  int
+	data  map[string]string
+	order []string
+}
+
+// NewKeyTable remembers size payloads, DefaultKeyTableSize when size is not
+// positive.
+func NewKeyTable(size int) *KeyTable {
+	if size <= 0 {
+		size = DefaultKeyTableSize
+	}
+	return &KeyTable{
+		size: size,
+		data: make(map[string]string, size),
+	}
+}
+
+func (t *KeyTable) shorten(data string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := keyPrefix + random.Token(keyLength)
+	if len(t.order) >= t.size {
+		delete(t.data, t.order[0])
+		t.order = t.order[1:]
+	}
+	t.data[key] = data
+	t.order = append(t.order, key)
+	return key
+}
+
+func (t *KeyTable) expand(key string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data, ok := t.data[key]
+	return data, ok
+}
@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestMuxRoutes(t *testing.T) {
+	m := NewBotMux()
+	for _, pattern := range []string{"/start", "/add", "list/{id}", "list/{id}/page/{n}", "wish/{id}/reserve", DefaultMessage} {
+		m.Handle(pattern, func(context.Context, *Request) {})
+	}
+	tests := []struct {
+		data   string
+		route  string
+		params map[string]string
+		args   string
+	}{
+		{data: "/start", route: "/start"},
+		{data: "/start token", route: "/start", args: "token"},
+		{data: "/add\nfirst line\nsecond line", route: "/add", args: "first line\nsecond line"},
+		{data: "/add\ttea  ", route: "/add", args: "tea"},
+		{data: "list/abc", route: "list/{id}", params: map[string]string{"id": "abc"}},
+		{data: "list/abc/page/2", route: "list/{id}/page/{n}", params: map[string]string{"id": "abc", "n": "2"}},
+		{data: "wish/x1/reserve", route: "wish/{id}/reserve", params: map[string]string{"id": "x1"}},
+		{data: "wish/x1/unreserve", route: DefaultMessage},
+		{data: "list/", route: DefaultMessage},
+		{data: "list/abc/page", route: DefaultMessage},
+		{data: "/unknown command", route: DefaultMessage},
+		{data: "just text", route: DefaultMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			r := &Request{Data: tt.data, Args: "stale", Params: map[string]string{"stale": "1"}}
+			m.ServeBot(context.Background(), r)
+			if r.Route != tt.route || r.Args != tt.args || !maps.Equal(r.Params, tt.params) {
+				t.Errorf("routed to %q with args %q and params %v, want %q, %q, %v",
+					r.Route, r.Args, r.Params, tt.route, tt.args, tt.params)
+			}
+		})
+	}
+}
+
+func TestFill(t *testing.T) {
+	if got := Fill("list/{id}/page/{n}", "abc", "2"); got != "list/abc/page/2" {
+		t.Errorf("Fill() = %q", got)
+	}
+	if got := Fill("list/{id}/page/{n}", "abc"); got != "list/abc/page/{n}" {
+		t.Errorf("Fill() with a missing value = %q", got)
+	}
+}
+
+func TestKeyTable(t *testing.T) {
+	m := NewBotMux()
+	var got *Request
+	m.Handle("list/{id}/page/{n}", func(_ context.Context, r *Request) { got = r })
+	m.Handle(DefaultMessage, func(_ context.Context, r *Request) { got = r })
+
+	long := Fill("list/{id}/page/{n}", strings.Repeat("x", MaxCallbackData), "2")
+	if data := m.Data(long); data != long {
+		t.Errorf("Data() without a key table = %q, want the data itself", data)
+	}
+	m.UseKeys(NewKeyTable(2))
+	if data := m.Data("list/abc/page/2"); data != "list/abc/page/2" {
+		t.Errorf("Data() of short data = %q, want the data itself", data)
+	}
+	key := m.Data(long)
+	if len(key) > MaxCallbackData || !strings.HasPrefix(key, keyPrefix) {
+		t.Fatalf("Data() = %q, want a short key", key)
+	}
+	m.ServeBot(context.Background(), &Request{Data: key})
+	if got.Data != long || got.Param("n") != "2" {
+		t.Errorf("key routed as %q with params %v, want %q", got.Data, got.Params, long)
+	}
+
+	// The table forgets the oldest keys beyond its size.
+	m.Data(long + "1")
+	m.Data(long + "2")
+	m.ServeBot(context.Background(), &Request{Data: key})
+	if got.Route != DefaultMessage {
+		t.Errorf("evicted key routed to %q, want %q", got.Route, DefaultMessage)
+	}
+}
+
+func TestKeyTableSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		table := NewKeyTable(size)
+		if table.size != DefaultKeyTableSize {
+			t.Errorf("NewKeyTable(%d) size = %d, want %d", size, table.size, DefaultKeyTableSize)
+		}
+		key := table.shorten("data")
+		if data, ok := table.expand(key); !ok || data != "data" {
+			t.Errorf("expand() = %q, %v, want data", data, ok)
+		}
+	}
+}
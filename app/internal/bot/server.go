@@ -2,37 +2,122 @@ package bot
 
 import (
 	"context"
+	"log/slog"
+	"sync"
 
+	"github.com/eugene-static/wishlist_bot/app/lib/lgr"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+const (
+	DefaultWorkers   = 16
+	DefaultQueueSize = 64
+)
+
 type Server struct {
+	log    *lgr.Log
 	bot    *Bot
 	router Handler
+	queues []chan *Request
 }
 
-func NewServer(bot *Bot, router Handler) *Server {
+// NewServer creates a server handling updates with the given number of
+// workers, each buffering up to queueSize updates.
+func NewServer(log *lgr.Log, bot *Bot, router Handler, workers int, queueSize int) *Server {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	queues := make([]chan *Request, workers)
+	for i := range queues {
+		queues[i] = make(chan *Request, queueSize)
+	}
 	return &Server{
+		log:    log,
 		bot:    bot,
 		router: router,
+		queues: queues,
 	}
 }
 
 type Request struct {
 	Chat *tgbotapi.Chat
 	Data string
+	Args string
+	// Route is the pattern the request was routed by, empty until it is.
+	Route string
+	// Params holds the values of the pattern parameters the request matched.
+	Params map[string]string
+	// CallbackID and MessageID identify the button press and the message with
+	// the button. Both are empty for plain messages.
+	CallbackID string
+	MessageID  int
+	// Toast is shown to the user when the callback query is answered.
+	Toast string
+	// Language is the language code of the user's Telegram client.
+	Language string
+}
+
+func (r *Request) Param(name string) string {
+	return r.Params[name]
 }
 
+// Listen hands updates out to the workers. Updates from one chat always go to
+// the same worker, so they are handled one at a time and in order. When the
+// worker is busy and its queue is full Listen blocks, so updates are not read
+// faster than they are handled. Listen returns once updates is closed and
+// every update read from it has been handled.
 func (s *Server) Listen(ctx context.Context, updates tgbotapi.UpdatesChannel) {
+	var wg sync.WaitGroup
+	for _, queue := range s.queues {
+		wg.Add(1)
+		go func(queue chan *Request) {
+			defer wg.Done()
+			for r := range queue {
+				s.serve(ctx, r)
+			}
+		}(queue)
+	}
 	for update := range updates {
 		r := new(Request)
 		if update.Message != nil {
 			r.Chat = update.Message.Chat
 			r.Data = update.Message.Text
-		} else if update.CallbackQuery != nil {
+		} else if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
 			r.Chat = update.CallbackQuery.Message.Chat
 			r.Data = update.CallbackQuery.Data
+			r.CallbackID = update.CallbackQuery.ID
+			r.MessageID = update.CallbackQuery.Message.MessageID
+		} else {
+			continue
 		}
-		go s.router.ServeBot(ctx, r)
+		if from := update.SentFrom(); from != nil {
+			r.Language = from.LanguageCode
+		}
+		queue := s.queues[uint64(r.Chat.ID)%uint64(len(s.queues))]
+		select {
+		case queue <- r:
+		default:
+			s.log.Warn("worker queue is full", slog.Int64("user_id", r.Chat.ID))
+			queue <- r
+		}
+	}
+	for _, queue := range s.queues {
+		close(queue)
+	}
+	wg.Wait()
+}
+
+// serve handles the request and answers the callback query it came with,
+// so the button never keeps spinning.
+func (s *Server) serve(ctx context.Context, r *Request) {
+	s.router.ServeBot(ctx, r)
+	if r.CallbackID == "" {
+		return
+	}
+	if err := s.bot.Answer(r.CallbackID, r.Toast); err != nil {
+		s.log.Errorf("error answering callback query", err, slog.Int64("user_id", r.Chat.ID))
 	}
 }
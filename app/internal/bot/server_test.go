@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/lib/lgr"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func message(chatID int64, text string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}, Text: text}}
+}
+
+// TestServerKeepsChatOrder checks that the updates of every chat are handled
+// one at a time and in order, and that Listen waits for all of them.
+func TestServerKeepsChatOrder(t *testing.T) {
+	const (
+		chats    = 20
+		messages = 50
+	)
+	var (
+		mu      sync.Mutex
+		got     = make(map[int64][]int)
+		running = make(map[int64]bool)
+	)
+	router := HandlerFunc(func(_ context.Context, r *Request) {
+		n, _ := strconv.Atoi(r.Data)
+		mu.Lock()
+		if running[r.Chat.ID] {
+			t.Errorf("chat %d is handled by two workers at once", r.Chat.ID)
+		}
+		running[r.Chat.ID] = true
+		mu.Unlock()
+		if n%10 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		mu.Lock()
+		got[r.Chat.ID] = append(got[r.Chat.ID], n)
+		running[r.Chat.ID] = false
+		mu.Unlock()
+	})
+	updates := make(chan tgbotapi.Update)
+	go func() {
+		for i := 0; i < messages; i++ {
+			for chat := int64(1); chat <= chats; chat++ {
+				updates <- message(chat, strconv.Itoa(i))
+			}
+		}
+		close(updates)
+	}()
+	NewServer(lgr.New(io.Discard, ""), nil, router, 4, 2).Listen(context.Background(), updates)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for chat := int64(1); chat <= chats; chat++ {
+		if len(got[chat]) != messages {
+			t.Fatalf("chat %d: handled %d updates, want %d", chat, len(got[chat]), messages)
+		}
+		for i, n := range got[chat] {
+			if n != i {
+				t.Fatalf("chat %d: handled %v, want them in order", chat, got[chat])
+			}
+		}
+	}
+}
+
+// TestServerChatsRunInParallel checks that a slow chat does not hold up the
+// chats handled by other workers.
+func TestServerChatsRunInParallel(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan struct{})
+	router := HandlerFunc(func(_ context.Context, r *Request) {
+		switch r.Chat.ID {
+		case 1:
+			<-release
+		case 2:
+			close(done)
+		}
+	})
+	updates := make(chan tgbotapi.Update, 2)
+	updates <- message(1, "slow")
+	updates <- message(2, "fast")
+	close(updates)
+	listened := make(chan struct{})
+	go func() {
+		NewServer(lgr.New(io.Discard, ""), nil, router, 2, 0).Listen(context.Background(), updates)
+		close(listened)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("chat 2 waited for chat 1")
+	}
+	select {
+	case <-listened:
+		t.Fatal("Listen returned before chat 1 was handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-listened
+}
+
+func TestServerSkipsOtherUpdates(t *testing.T) {
+	var handled []string
+	router := HandlerFunc(func(_ context.Context, r *Request) {
+		handled = append(handled, r.Data)
+	})
+	updates := make(chan tgbotapi.Update, 3)
+	updates <- tgbotapi.Update{EditedMessage: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, Text: "edited"}}
+	updates <- tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{ID: "1", Data: "inline"}}
+	updates <- message(1, "text")
+	close(updates)
+	NewServer(lgr.New(io.Discard, ""), nil, router, 1, 0).Listen(context.Background(), updates)
+	if len(handled) != 1 || handled[0] != "text" {
+		t.Errorf("handled %v, want only the message", handled)
+	}
+}
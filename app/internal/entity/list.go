@@ -4,9 +4,42 @@ type User struct {
 	ID       int64
 	Name     string
 	Password []byte
+	// Language is the language of the bot texts the user reads, empty until chosen.
+	Language string
+	// Banned users are ignored by the bot.
+	Banned bool
 }
+
+// Stats are the totals of the stored data.
+type Stats struct {
+	Users     int
+	Banned    int
+	Wishlists int
+	Wishes    int
+}
+type Wishlist struct {
+	ID     string
+	UserID int64
+	// Name is empty for the list every user starts with, which is shown
+	// with the default name in the language of the reader.
+	Name     string
+	Password []byte
+	Hidden   bool
+	// ShareToken is the payload of the deep link opening the list, empty if sharing is off.
+	ShareToken string
+}
+
 type Wish struct {
-	ID      string
-	Content string
-	UserID  int64
+	ID       string
+	Content  string
+	Link     string
+	Price    int64
+	Currency string
+	Priority int
+	Quantity int
+	Note     string
+	ListID   string
+	UserID   int64
+	// ReservedBy is the ID of the user who promised to gift the wish, 0 if nobody did.
+	ReservedBy int64
 }
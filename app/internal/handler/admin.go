@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/bot"
+	"github.com/eugene-static/wishlist_bot/app/internal/entity"
+	"github.com/eugene-static/wishlist_bot/app/internal/session"
+	"github.com/eugene-static/wishlist_bot/app/lib/format"
+	"github.com/eugene-static/wishlist_bot/app/lib/i18n"
+	"github.com/eugene-static/wishlist_bot/app/lib/lgr"
+)
+
+// SetAdmins allows the users with the given IDs to run the admin commands.
+func (h *Handle) SetAdmins(ids []int64) {
+	h.admins = ids
+}
+
+// SetSupport sets the contact users are referred to when something fails.
+func (h *Handle) SetSupport(contact string) {
+	h.support = contact
+}
+
+func (h *Handle) isAdmin(id int64) bool {
+	return slices.Contains(h.admins, id)
+}
+
+// admin lets only admins through. Others get no reply, as if the command
+// did not exist.
+func (h *Handle) admin(next bot.Handler) bot.Handler {
+	return bot.HandlerFunc(func(ctx context.Context, r *bot.Request) {
+		if !h.isAdmin(r.Chat.ID) {
+			h.logger(ctx).Info("admin command rejected")
+			return
+		}
+		next.ServeBot(ctx, r)
+	})
+}
+
+func (h *Handle) stats(ctx context.Context, r *bot.Request) {
+	stats, err := h.service.Stats(ctx)
+	if err != nil {
+		h.errorCode(ctx, errAdmin, err)
+		return
+	}
+	sessions, err := h.mgr.Count(ctx)
+	if err != nil {
+		h.errorCode(ctx, errAdmin, err)
+		return
+	}
+	h.sendText(ctx, lvlEmpty, h.render(ctx, textAdminStats, i18n.Args{
+		"users":    stats.Users,
+		"banned":   stats.Banned,
+		"lists":    stats.Wishlists,
+		"wishes":   stats.Wishes,
+		"sessions": sessions,
+	}))
+}
+
+func (h *Handle) inspectUser(ctx context.Context, r *bot.Request) {
+	target, ok := h.findUser(ctx, r, actionUser)
+	if !ok {
+		return
+	}
+	lists, err := h.service.GetWishlists(ctx, target.ID)
+	if err != nil {
+		h.errorCode(ctx, errAdmin, err)
+		return
+	}
+	wishes := 0
+	for _, list := range lists {
+		items, err := h.service.GetWishes(ctx, list.ID)
+		if err != nil {
+			h.errorCode(ctx, errAdmin, err)
+			return
+		}
+		wishes += len(items)
+	}
+	status := labelActive
+	if target.Banned {
+		status = labelBanned
+	}
+	h.sendText(ctx, lvlEmpty, h.render(ctx, textAdminUser, i18n.Args{
+		"id":       target.ID,
+		"name":     format.Escape(target.Name),
+		"language": target.Language,
+		"status":   h.text(ctx, status),
+		"lists":    len(lists),
+		"wishes":   wishes,
+	}))
+}
+
+func (h *Handle) ban(banned bool) bot.HandlerFunc {
+	command, done := actionUnban, textUserUnbanned
+	if banned {
+		command, done = actionBan, textUserBanned
+	}
+	return func(ctx context.Context, r *bot.Request) {
+		target, ok := h.findUser(ctx, r, command)
+		if !ok {
+			return
+		}
+		if banned && h.isAdmin(target.ID) {
+			h.send(ctx, lvlEmpty, textBanAdmin)
+			return
+		}
+		if err := h.service.SetBanned(ctx, target.ID, banned); err != nil {
+			h.errorCode(ctx, errAdmin, err)
+			return
+		}
+		// The session keeps the old ban status, so the user starts a new one.
+		if err := h.mgr.Delete(ctx, target.ID); err != nil {
+			h.errorCode(ctx, errAdmin, err)
+			return
+		}
+		h.logger(ctx).Info("ban status changed", slog.Int64("target", target.ID), slog.Bool("banned", banned))
+		h.sendText(ctx, lvlEmpty, h.render(ctx, done, i18n.Args{"name": format.Escape(target.Name), "id": target.ID}))
+	}
+}
+
+// findUser looks up the user given in the arguments of command by ID or
+// username. It replies to the admin itself when there is no such user.
+func (h *Handle) findUser(ctx context.Context, r *bot.Request, command string) (*entity.User, bool) {
+	if r.Args == "" {
+		h.sendText(ctx, lvlEmpty, h.render(ctx, textAdminUsage, i18n.Args{"command": command}))
+		return nil, false
+	}
+	var (
+		user *entity.User
+		err  error
+	)
+	if id, convErr := strconv.ParseInt(r.Args, 10, 64); convErr == nil {
+		user, err = h.service.GetUser(ctx, id)
+	} else {
+		user, err = h.service.GetUserByUsername(ctx, strings.TrimPrefix(r.Args, "@"))
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.send(ctx, lvlEmpty, textUserNotFound)
+		} else {
+			h.errorCode(ctx, errAdmin, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+// previewBroadcast shows the admin the message as users will get it before
+// it is sent.
+func (h *Handle) previewBroadcast(ctx context.Context, r *bot.Request) {
+	if r.Args == "" {
+		h.send(ctx, lvlEmpty, textBroadcastUsage)
+		return
+	}
+	ids, err := h.service.GetUserIDs(ctx)
+	if err != nil {
+		h.errorCode(ctx, errAdmin, err)
+		return
+	}
+	user := session.FromContext(ctx)
+	user.Broadcast = r.Args
+	text := format.Join(
+		format.Raw(h.bot.Config.Plural(user.Language, textBroadcastPreview, len(ids), nil)+"\n\n"),
+		format.Text(r.Args),
+	)
+	h.sendMarkup(ctx, string(text), bot.NewMarkup(bot.NewRow(
+		bot.NewButton(h.text(ctx, buttonSend), actionSendBroadcast),
+		bot.NewButton(h.text(ctx, buttonCancel), actionDropBroadcast),
+	)))
+}
+
+func (h *Handle) sendBroadcast(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	text := user.Broadcast
+	if text == "" {
+		h.show(ctx, r, bot.Reply{Level: lvlEmpty, Text: h.text(ctx, textWrongRequest)})
+		return
+	}
+	user.Broadcast = ""
+	ids, err := h.service.GetUserIDs(ctx)
+	if err != nil {
+		h.errorCode(ctx, errAdmin, err)
+		return
+	}
+	h.show(ctx, r, bot.Reply{Level: lvlEmpty, Text: h.bot.Config.Plural(user.Language, textBroadcastStarted, len(ids), nil)})
+	// Sending paces itself to the rate limits, which takes long for many
+	// users, so the admin's chat is not held up meanwhile.
+	h.broadcasts.Add(1)
+	go func() {
+		defer h.broadcasts.Done()
+		h.broadcast(h.logger(ctx), user.ID, user.Language, format.Escape(text), ids)
+	}()
+}
+
+// Wait blocks until the broadcasts in progress are sent or ctx is done.
+func (h *Handle) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.broadcasts.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Handle) broadcast(log *lgr.Log, adminID int64, lang string, text string, ids []int64) {
+	sent, failed := 0, 0
+	for _, id := range ids {
+		if _, err := h.bot.Reply(id, bot.Reply{Level: lvlEmpty, Text: text}); err != nil {
+			log.Debug("broadcast message failed", slog.Int64("recipient", id), slog.Any("error", err))
+			failed++
+			continue
+		}
+		sent++
+	}
+	log.Info("broadcast finished", slog.Int("sent", sent), slog.Int("failed", failed))
+	done := h.bot.Config.Render(lang, textBroadcastDone, i18n.Args{"sent": sent, "failed": failed})
+	if _, err := h.bot.Reply(adminID, bot.Reply{Level: lvlEmpty, Lang: lang, Text: done}); err != nil {
+		log.Errorf("error sending message", err)
+	}
+}
+
+func (h *Handle) cancelBroadcast(ctx context.Context, r *bot.Request) {
+	session.FromContext(ctx).Broadcast = ""
+	h.show(ctx, r, bot.Reply{Level: lvlEmpty, Text: h.text(ctx, textBroadcastCancelled)})
+}
+
+func (h *Handle) adminHelp(ctx context.Context, r *bot.Request) {
+	h.send(ctx, lvlEmpty, textAdminHelp)
+}
@@ -2,24 +2,33 @@ package handler
 
 import (
 	"context"
-	"log/slog"
 
 	"github.com/eugene-static/wishlist_bot/app/internal/bot"
 )
 
-func (h *Handle) callback(code int, level int, action string) bot.HandlerFunc {
+func (h *Handle) callback(key string, level int) bot.HandlerFunc {
 	return func(ctx context.Context, r *bot.Request) {
-		user, err := h.getUser(ctx, r)
-		if err != nil {
-			h.error(nil, err)
-			return
+		h.send(ctx, level, key)
+	}
+}
+
+// navigate shows the message in place of the one with the pressed button.
+func (h *Handle) navigate(key string, level int) bot.HandlerFunc {
+	return func(ctx context.Context, r *bot.Request) {
+		h.show(ctx, r, bot.Reply{Level: level, Text: h.text(ctx, key)})
+	}
+}
+
+func (h *Handle) enter(state string) bot.HandlerFunc {
+	return func(ctx context.Context, r *bot.Request) {
+		if err := h.fsm.Enter(ctx, r, state); err != nil {
+			h.error(ctx, err)
 		}
-		user.Action = action
-		h.log.Debug("new callback update",
-			slog.Int64("user_id", user.ID),
-			slog.String("username", user.Name),
-			slog.String("data", r.Data),
-		)
-		h.send(user, level, code)
+	}
+}
+
+func (h *Handle) invalid(key string, level int) func(context.Context, *bot.Request, error) {
+	return func(ctx context.Context, r *bot.Request, _ error) {
+		h.callback(key, level)(ctx, r)
 	}
 }
@@ -1,23 +1,50 @@
 package handler
 
 import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
 	"github.com/eugene-static/wishlist_bot/app/internal/bot"
-	"github.com/eugene-static/wishlist_bot/app/lib/format"
+	"github.com/eugene-static/wishlist_bot/app/lib/i18n"
 )
 
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Button labels are keys of the texts in locales.
 const (
-	buttonMyWishlist = "Мой вишлист"
-	buttonFindUser   = "Найти пользователя"
-	buttonAdd        = "Добавить"
-	buttonDelete     = "Удалить"
-	buttonPassword   = "Пароль"
-	buttonBack       = "Назад"
-	buttonCancel     = "Отмена"
-	buttonOK         = "ОК"
+	buttonMyWishlist    = "buttonMyWishlist"
+	buttonFindUser      = "buttonFindUser"
+	buttonAdd           = "buttonAdd"
+	buttonDelete        = "buttonDelete"
+	buttonPassword      = "buttonPassword"
+	buttonBack          = "buttonBack"
+	buttonCancel        = "buttonCancel"
+	buttonOK            = "buttonOK"
+	buttonReserve       = "buttonReserve"
+	buttonUnreserve     = "buttonUnreserve"
+	buttonNewList       = "buttonNewList"
+	buttonRenameList    = "buttonRenameList"
+	buttonVisibility    = "buttonVisibility"
+	buttonDeleteList    = "buttonDeleteList"
+	buttonConfirmDelete = "buttonConfirmDelete"
+	buttonHiddenList    = "buttonHiddenList"
+	buttonShare         = "buttonShare"
+	buttonNewLink       = "buttonNewLink"
+	buttonRevokeLink    = "buttonRevokeLink"
+	buttonSkip          = "buttonSkip"
+	buttonPriority      = "buttonPriority"
+	buttonPrevPage      = "buttonPrevPage"
+	buttonNextPage      = "buttonNextPage"
+	buttonPage          = "buttonPage"
+	buttonLanguage      = "buttonLanguage"
+	buttonSend          = "buttonSend"
 )
 
-const admin = "@eugene_static"
-
 const (
 	actionAdd       = "/add"
 	actionDelete    = "/delete"
@@ -25,16 +52,83 @@ const (
 	actionShowUser  = "/show_user"
 	actionShowMe    = "/show_me"
 	actionBack      = "/back"
+	actionReserve   = "wish/{id}/reserve"
+	actionUnreserve = "wish/{id}/unreserve"
+	actionList      = "/list"
+	actionOpenList  = "list/{id}"
+	actionListPage  = "list/{id}/page/{n}"
+	actionViewPage  = "view/{id}/page/{n}"
+	actionNoop      = "/noop"
+	actionNewList   = "/new_list"
+	actionRename    = "/rename_list"
+	actionHide      = "/hide_list"
+	actionDropList  = "/delete_list"
+	actionConfirm   = "/confirm_delete_list"
+	actionView      = "view/{id}"
+	actionUserLists = "/user_lists"
 	messageStart    = "/start"
-	messageAdd      = "/message_add"
-	messageDelete   = "/message_delete"
-	messageShowUser = "/message_show_user"
-	messagePassword = "/message_password"
+	actionShare     = "/share"
+	actionNewLink   = "/new_link"
+	actionRevoke    = "/revoke_link"
+	actionSkip      = "/skip"
+	actionLanguage  = "/language"
+	actionSetLang   = "language/{lang}"
+)
+
+// Admin commands, see admin.go.
+const (
+	actionAdmin         = "/admin"
+	actionStats         = "/stats"
+	actionUser          = "/user"
+	actionBan           = "/ban"
+	actionUnban         = "/unban"
+	actionBroadcast     = "/broadcast"
+	actionSendBroadcast = "/send_broadcast"
+	actionDropBroadcast = "/cancel_broadcast"
+)
+
+const (
+	stateAddWish      = "add_wish"
+	stateWishPrice    = "wish_price"
+	stateWishLink     = "wish_link"
+	stateWishPriority = "wish_priority"
+	stateDelete       = "delete_wishes"
+	statePassword     = "password"
+	stateShowUser     = "show_user"
+	stateNewList      = "new_list"
+	stateRename       = "rename_list"
+	stateSharePwd     = "share_password"
+	stateTimeout      = 15 * time.Minute
+)
+
+const (
+	rateLimit = 60
+	rateBurst = 20
+)
+
+const keyTableSize = 10000
+
+const (
+	labelReserved      = "labelReserved"
+	labelReservedByYou = "labelReservedByYou"
+	labelActive        = "labelActive"
+	labelBanned        = "labelBanned"
+	languageName       = "languageName"
+	defaultLanguage    = "ru"
 )
 
 const (
-	deleteAllWishes = "Удалить всё"
-	deletePassword  = "Удалить пароль"
+	defaultListName   = "defaultListName"
+	maxListNameLength = 64
+	shareTokenLength  = 24
+	defaultPageSize   = 10
+	deepLink          = "https://t.me/%s?start=%s"
+)
+
+// Keys of the texts users type to delete all wishes or the password.
+const (
+	deleteAllWishes = "inputDeleteAll"
+	deletePassword  = "inputDeletePassword"
 )
 
 const (
@@ -46,23 +140,63 @@ const (
 	lvlEdit
 	lvlService
 	lvlServiceExt
+	lvlEditLists
+	lvlConfirm
+	lvlShare
+	lvlWishStep
+)
+
+const (
+	textGreetings       = "textGreetings"
+	textAddWish         = "textAddWish"
+	textDeleteWish      = "textDeleteWish"
+	textEnterPassword   = "textEnterPassword"
+	textWrongPassword   = "textWrongPassword"
+	textNoSpace         = "textNoSpace"
+	textEnterUsername   = "textEnterUsername"
+	textSuccess         = "textSuccess"
+	textNoWishes        = "textNoWishes"
+	textUserNotFound    = "textUserNotFound"
+	textWrongRequest    = "textWrongRequest"
+	textDefaultMessage  = "textDefaultMessage"
+	textError           = "textError"
+	textStaleWishes     = "textStaleWishes"
+	textAlreadyReserved = "textAlreadyReserved"
+	textChooseList      = "textChooseList"
+	textChooseUserList  = "textChooseUserList"
+	textEnterListName   = "textEnterListName"
+	textWrongListName   = "textWrongListName"
+	textConfirmDelete   = "textConfirmDelete"
+	textListHidden      = "textListHidden"
+	textListVisible     = "textListVisible"
+	textShareLink       = "textShareLink"
+	textLinkRevoked     = "textLinkRevoked"
+	textLinkInvalid     = "textLinkInvalid"
+	textSharedPassword  = "textSharedPassword"
+	textWishPrice       = "textWishPrice"
+	textWishLink        = "textWishLink"
+	textWishPriority    = "textWishPriority"
+	textWrongPrice      = "textWrongPrice"
+	textWrongLink       = "textWrongLink"
+	textStateExpired    = "textStateExpired"
+	textWishCount       = "textWishCount"
+	textChooseLanguage  = "textChooseLanguage"
+	textErrorSupport    = "textErrorSupport"
 )
 
 const (
-	textGreetings = 100 + iota
-	textAddWish
-	textDeleteWish
-	textEnterPassword
-	textWrongPassword
-	textNoSpace
-	textEnterUsername
-	textSuccess
-	textWishList
-	textNoWishes
-	textUserNotFound
-	textWrongRequest
-	textDefaultMessage
-	textError
+	textAdminHelp          = "textAdminHelp"
+	textAdminUsage         = "textAdminUsage"
+	textAdminStats         = "textAdminStats"
+	textAdminUser          = "textAdminUser"
+	textUserBanned         = "textUserBanned"
+	textUserUnbanned       = "textUserUnbanned"
+	textBanAdmin           = "textBanAdmin"
+	textBroadcastUsage     = "textBroadcastUsage"
+	textBroadcastPreview   = "textBroadcastPreview"
+	textBroadcastStarted   = "textBroadcastStarted"
+	textBroadcastDone      = "textBroadcastDone"
+	textBroadcastCancelled = "textBroadcastCancelled"
 )
 
 const (
@@ -71,30 +205,167 @@ const (
 	errAddWish
 	errDelWish
 	errChangePass
+	errReserve
+	errList
+	errLanguage
+	errAdmin
 )
 
 func (h *Handle) Register() {
-	h.mux.Handle(bot.DefaultMessage, h.message)
-	h.mux.Handle(messageAdd, h.add(h.showMe))
-	h.mux.Handle(messageDelete, h.delete(h.showMe))
-	h.mux.Handle(messageShowUser, h.showUser)
-	h.mux.Handle(messagePassword, h.password)
-	h.mux.Handle(messageStart, h.start)
-	h.mux.Handle(actionShowMe, h.showMe)
-	h.mux.Handle(actionBack, h.callback(textGreetings, lvlStart, messageStart))
-	h.mux.Handle(actionAdd, h.callback(textAddWish, lvlEdit, messageAdd))
-	h.mux.Handle(actionDelete, h.callback(textDeleteWish, lvlEdit, messageDelete))
-	h.mux.Handle(actionPassword, h.callback(textEnterPassword, lvlEdit, messagePassword))
-	h.mux.Handle(actionShowUser, h.callback(textEnterUsername, lvlUser, messageShowUser))
+	h.registerStates()
+	h.mux.Use(
+		bot.Recover(h.log),
+		bot.Log(h.log),
+		bot.Timing(h.log),
+		bot.RateLimit(h.log, rateLimit, rateBurst, nil),
+		h.session,
+	)
+	h.mux.UseKeys(bot.NewKeyTable(keyTableSize))
+	// Commands interrupt the conversation the user is in.
+	handle := func(pattern string, handler bot.HandlerFunc) {
+		h.mux.Handle(pattern, func(ctx context.Context, r *bot.Request) {
+			h.fsm.Finish(ctx)
+			handler(ctx, r)
+		})
+	}
+	h.mux.Handle(bot.DefaultMessage, h.fsm.ServeBot)
+	// Browsing someone else's lists keeps the lookup going, so another
+	// username or password can be entered right away.
+	h.mux.Handle(actionUserLists, h.userLists)
+	h.mux.Handle(actionView, h.viewList)
+	h.mux.Handle(actionViewPage, h.viewList)
+	h.mux.Handle(actionNoop, func(context.Context, *bot.Request) {})
+	h.mux.Handle(actionReserve, h.reserve(true))
+	h.mux.Handle(actionUnreserve, h.reserve(false))
+	handle(messageStart, h.start)
+	handle(actionShowMe, h.showMe)
+	handle(actionBack, h.navigate(textGreetings, lvlStart))
+	handle(actionAdd, h.enter(stateAddWish))
+	handle(actionDelete, h.enter(stateDelete))
+	handle(actionPassword, h.enter(statePassword))
+	handle(actionShowUser, h.enter(stateShowUser))
+	handle(actionList, h.openList)
+	handle(actionOpenList, h.openList)
+	handle(actionListPage, h.openList)
+	handle(actionNewList, h.enter(stateNewList))
+	handle(actionRename, h.enter(stateRename))
+	handle(actionHide, h.hideList)
+	handle(actionDropList, h.callback(textConfirmDelete, lvlConfirm))
+	handle(actionConfirm, h.deleteList)
+	handle(actionShare, h.share(false))
+	handle(actionNewLink, h.share(true))
+	handle(actionRevoke, h.revokeShare)
+	handle(actionLanguage, h.chooseLanguage)
+	handle(actionSetLang, h.setLanguage)
+	admin := func(pattern string, handler bot.HandlerFunc) {
+		h.mux.Handle(pattern, h.admin(bot.HandlerFunc(func(ctx context.Context, r *bot.Request) {
+			h.fsm.Finish(ctx)
+			handler(ctx, r)
+		})).ServeBot)
+	}
+	admin(actionAdmin, h.adminHelp)
+	admin(actionStats, h.stats)
+	admin(actionUser, h.inspectUser)
+	admin(actionBan, h.ban(true))
+	admin(actionUnban, h.ban(false))
+	admin(actionBroadcast, h.previewBroadcast)
+	admin(actionSendBroadcast, h.sendBroadcast)
+	admin(actionDropBroadcast, h.cancelBroadcast)
 }
 
-func (h *Handle) SetConfig() {
+func (h *Handle) registerStates() {
+	h.fsm.Handle(stateAddWish, bot.State{
+		Prompt:   h.callback(textAddWish, lvlEdit),
+		Validate: notEmpty,
+		Invalid:  h.invalid(textWrongRequest, lvlEdit),
+		Handle:   h.addWish,
+		Next:     wishSteps,
+		Timeout:  stateTimeout,
+		Expired:  h.callback(textStateExpired, lvlService),
+	})
+	h.fsm.Handle(stateWishPrice, bot.State{
+		Prompt:   h.callback(textWishPrice, lvlWishStep),
+		Validate: skippable(validPrice),
+		Invalid:  h.invalid(textWrongPrice, lvlWishStep),
+		Handle:   h.wishPrice,
+		Next:     wishSteps[1:],
+		Timeout:  stateTimeout,
+		Expired:  h.callback(textStateExpired, lvlService),
+	})
+	h.fsm.Handle(stateWishLink, bot.State{
+		Prompt:   h.callback(textWishLink, lvlWishStep),
+		Validate: skippable(validLink),
+		Invalid:  h.invalid(textWrongLink, lvlWishStep),
+		Handle:   h.wishLink,
+		Next:     wishSteps[2:],
+		Timeout:  stateTimeout,
+		Expired:  h.callback(textStateExpired, lvlService),
+	})
+	h.fsm.Handle(stateWishPriority, bot.State{
+		Prompt:   h.priorityPrompt,
+		Validate: skippable(validPriority),
+		Invalid:  h.invalid(textWrongRequest, lvlWishStep),
+		Handle:   h.wishPriority,
+		Timeout:  stateTimeout,
+		Expired:  h.callback(textStateExpired, lvlService),
+	})
+	h.fsm.Handle(stateDelete, bot.State{
+		Prompt: h.callback(textDeleteWish, lvlEdit),
+		Handle: h.delete(h.openList),
+	})
+	h.fsm.Handle(statePassword, bot.State{
+		Prompt:   h.callback(textEnterPassword, lvlEdit),
+		Validate: h.validPassword,
+		Invalid:  h.invalid(textNoSpace, lvlEdit),
+		Handle:   h.password,
+	})
+	h.fsm.Handle(stateShowUser, bot.State{
+		Prompt: h.callback(textEnterUsername, lvlUser),
+		Handle: h.showUser,
+	})
+	h.fsm.Handle(stateNewList, bot.State{
+		Prompt:   h.callback(textEnterListName, lvlEditLists),
+		Validate: validListName,
+		Invalid:  h.invalid(textWrongListName, lvlEditLists),
+		Handle:   h.newList,
+	})
+	h.fsm.Handle(stateRename, bot.State{
+		Prompt:   h.callback(textEnterListName, lvlEdit),
+		Validate: validListName,
+		Invalid:  h.invalid(textWrongListName, lvlEdit),
+		Handle:   h.renameList,
+	})
+	h.fsm.Handle(stateSharePwd, bot.State{
+		Prompt: h.callback(textSharedPassword, lvlUser),
+		Handle: h.sharedPassword,
+	})
+}
+
+// SetConfig loads the texts, overriding the built-in ones with the files in
+// the locales directory if it is set, and sets up the keyboards.
+func (h *Handle) SetConfig(locales string) error {
+	catalog := i18n.New(defaultLanguage)
+	builtin, err := fs.Sub(localeFiles, "locales")
+	if err != nil {
+		return err
+	}
+	if err = catalog.Load(builtin); err != nil {
+		return err
+	}
+	if locales != "" {
+		if err = catalog.Load(os.DirFS(locales)); err != nil {
+			return fmt.Errorf("error loading locales: %w", err)
+		}
+	}
+	h.bot.Config.UseCatalog(catalog)
 	msg := bot.NewConfig(bot.ModeHTML)
 	h.bot.Config.Set(lvlEmpty, msg)
 	msg.ReplyMarkup = bot.NewMarkup(
 		bot.NewRow(
 			bot.NewButton(buttonMyWishlist, actionShowMe),
-			bot.NewButton(buttonFindUser, actionShowUser)))
+			bot.NewButton(buttonFindUser, actionShowUser)),
+		bot.NewRow(
+			bot.NewButton(buttonLanguage, actionLanguage)))
 	h.bot.Config.Set(lvlStart, msg)
 	msg.ReplyMarkup = bot.NewMarkup(
 		bot.NewRow(
@@ -103,7 +374,15 @@ func (h *Handle) SetConfig() {
 			bot.NewButton(buttonPassword, actionPassword),
 		),
 		bot.NewRow(
-			bot.NewButton(buttonBack, actionBack),
+			bot.NewButton(buttonShare, actionShare),
+			bot.NewButton(buttonRenameList, actionRename),
+		),
+		bot.NewRow(
+			bot.NewButton(buttonVisibility, actionHide),
+			bot.NewButton(buttonDeleteList, actionDropList),
+		),
+		bot.NewRow(
+			bot.NewButton(buttonBack, actionShowMe),
 		))
 	h.bot.Config.Set(lvlMe, msg)
 	msg.ReplyMarkup = bot.NewMarkup(
@@ -112,7 +391,15 @@ func (h *Handle) SetConfig() {
 			bot.NewButton(buttonPassword, actionPassword),
 		),
 		bot.NewRow(
-			bot.NewButton(buttonBack, actionBack),
+			bot.NewButton(buttonShare, actionShare),
+			bot.NewButton(buttonRenameList, actionRename),
+		),
+		bot.NewRow(
+			bot.NewButton(buttonVisibility, actionHide),
+			bot.NewButton(buttonDeleteList, actionDropList),
+		),
+		bot.NewRow(
+			bot.NewButton(buttonBack, actionShowMe),
 		))
 	h.bot.Config.Set(lvlEmptyList, msg)
 	msg.ReplyMarkup = bot.NewMarkup(
@@ -121,34 +408,34 @@ func (h *Handle) SetConfig() {
 	h.bot.Config.Set(lvlUser, msg)
 	msg.ReplyMarkup = bot.NewMarkup(
 		bot.NewRow(
-			bot.NewButton(buttonOK, actionShowMe)))
+			bot.NewButton(buttonOK, actionList)))
 	h.bot.Config.Set(lvlService, msg)
 	msg.ReplyMarkup = bot.NewMarkup(
 		bot.NewRow(
-			bot.NewButton(buttonCancel, actionShowMe)))
+			bot.NewButton(buttonCancel, actionList)))
 	h.bot.Config.Set(lvlEdit, msg)
-	//
-	h.bot.Config.SetReplyMessage(textGreetings, "Итак, чем займемся?")
-	h.bot.Config.SetReplyMessage(textAddWish, "Введи описание и/или ссылку и отправь в чат одним сообщением:")
-	h.bot.Config.SetReplyMessage(textDeleteWish, "Введи через пробелы номера желаний из списка, которые нужно удалить. Например:\n"+
-		format.Format("1 3 10 6\n", format.Monotype)+
-		"Если хочешь удалить весь список, введи "+format.Format(deleteAllWishes, format.Monotype))
-	h.bot.Config.SetReplyMessage(textEnterPassword, "Пароль необходим для того, чтобы к твоему вишлисту был доступ только у тех, кто знает пароль. "+
-		"Им ты можешь делиться лично с кем-то или же опубликовать в своем профиле. "+
-		"Пароль может быть в любой форме, но не должен содержать пробелы. Например:"+
-		"🐈‍⬛💥💽\n"+
-		"Чтобы сбросить пароль и сделать вишлист общедоступным, введи:\n"+
-		format.Format(deletePassword, format.Monotype))
-	h.bot.Config.SetReplyMessage(textWrongPassword, "Неверный пароль. Поищи пароль в профиле пользователя либо же обратись к нему лично")
-	h.bot.Config.SetReplyMessage(textEnterUsername, "Введи юзернейм пользователя, чей вишлист ты хочешь посмотреть. Юзернейм можно найти в профиле пользователя.\n"+
-		"Если вишлист выбранного пользователя защищён паролем, то через пробел введи пароль. Например:\n"+
-		format.Format(admin+" пароль", format.Monotype))
-	h.bot.Config.SetReplyMessage(textSuccess, "Успешно")
-	h.bot.Config.SetReplyMessage(textNoWishes, "Здесь нет ни одного желания...")
-	h.bot.Config.SetReplyMessage(textUserNotFound, "Похоже, у этого пользователя нет вишлиста")
-	h.bot.Config.SetReplyMessage(textWrongRequest, "В запросе ошибка, попробуй снова")
-	h.bot.Config.SetReplyMessage(textNoSpace, "В пароле не должно содержаться пробелов. Попробуй другой")
-	h.bot.Config.SetReplyMessage(textDefaultMessage, "Не могу обработать сообщение")
+	msg.ReplyMarkup = bot.NewMarkup(
+		bot.NewRow(
+			bot.NewButton(buttonCancel, actionShowMe)))
+	h.bot.Config.Set(lvlEditLists, msg)
+	msg.ReplyMarkup = bot.NewMarkup(
+		bot.NewRow(
+			bot.NewButton(buttonConfirmDelete, actionConfirm),
+			bot.NewButton(buttonCancel, actionList)))
+	h.bot.Config.Set(lvlConfirm, msg)
+	msg.ReplyMarkup = bot.NewMarkup(
+		bot.NewRow(
+			bot.NewButton(buttonNewLink, actionNewLink),
+			bot.NewButton(buttonRevokeLink, actionRevoke)),
+		bot.NewRow(
+			bot.NewButton(buttonOK, actionList)))
+	h.bot.Config.Set(lvlShare, msg)
+	msg.ReplyMarkup = bot.NewMarkup(
+		bot.NewRow(
+			bot.NewButton(buttonSkip, actionSkip),
+			bot.NewButton(buttonCancel, actionList)))
+	h.bot.Config.Set(lvlWishStep, msg)
+	return nil
 }
 
 func (h *Handle) SetErrors() {
@@ -157,4 +444,8 @@ func (h *Handle) SetErrors() {
 	h.log.Set(errAddWish, "adding wish error")
 	h.log.Set(errDelWish, "deleting wish error")
 	h.log.Set(errChangePass, "changing password error")
+	h.log.Set(errReserve, "reserving wish error")
+	h.log.Set(errList, "updating wishlist error")
+	h.log.Set(errLanguage, "changing language error")
+	h.log.Set(errAdmin, "admin command error")
 }
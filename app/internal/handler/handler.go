@@ -6,11 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/eugene-static/wishlist_bot/app/internal/bot"
 	"github.com/eugene-static/wishlist_bot/app/internal/entity"
 	"github.com/eugene-static/wishlist_bot/app/internal/session"
+	"github.com/eugene-static/wishlist_bot/app/lib/format"
+	"github.com/eugene-static/wishlist_bot/app/lib/i18n"
 	"github.com/eugene-static/wishlist_bot/app/lib/lgr"
+	"github.com/eugene-static/wishlist_bot/app/lib/random"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -19,17 +24,41 @@ type User interface {
 	GetUserByUsername(ctx context.Context, username string) (*entity.User, error)
 	AddUser(ctx context.Context, user *entity.User) error
 	UpdateUser(ctx context.Context, id int64, username string, new []byte) error
+	SetLanguage(ctx context.Context, id int64, language string) error
+}
+
+type Admin interface {
+	SetBanned(ctx context.Context, id int64, banned bool) error
+	GetUserIDs(ctx context.Context) ([]int64, error)
+	Stats(ctx context.Context) (*entity.Stats, error)
+}
+
+type Wishlist interface {
+	AddWishlist(ctx context.Context, list *entity.Wishlist) error
+	GetWishlist(ctx context.Context, id string) (*entity.Wishlist, error)
+	GetWishlistByToken(ctx context.Context, token string) (*entity.Wishlist, error)
+	GetWishlists(ctx context.Context, userID int64) ([]*entity.Wishlist, error)
+	UpdateWishlist(ctx context.Context, list *entity.Wishlist) error
+	DeleteWishlist(ctx context.Context, userID int64, id string) (bool, error)
 }
 
 type List interface {
 	AddWish(ctx context.Context, wish *entity.Wish) error
-	GetWishlistByID(ctx context.Context, id int64) ([]*entity.Wish, error)
-	DeleteWishes(ctx context.Context, ids []string) error
+	GetWishes(ctx context.Context, listID string) ([]*entity.Wish, error)
+	DeleteWishes(ctx context.Context, userID int64, ids []string) (int64, error)
+}
+
+type Reservation interface {
+	ReserveWish(ctx context.Context, wishID string, userID int64) (bool, error)
+	UnreserveWish(ctx context.Context, wishID string, userID int64) (bool, error)
 }
 
 type Service interface {
 	User
+	Wishlist
 	List
+	Reservation
+	Admin
 }
 
 type Handle struct {
@@ -38,63 +67,154 @@ type Handle struct {
 	mgr     *session.Manager
 	bot     *bot.Bot
 	mux     *bot.Mux
+	fsm     *bot.FSM
+	// pageSize is the number of wishes shown on one page of a list.
+	pageSize int
+	admins   []int64
+	// support is the contact named in error messages, empty for none.
+	support string
+	// broadcasts tracks the broadcasts still being sent.
+	broadcasts sync.WaitGroup
 }
 
-func New(log *lgr.Log, service Service, mgr *session.Manager, b *bot.Bot, mux *bot.Mux) *Handle {
-	return &Handle{
-		log:     log,
-		service: service,
-		mgr:     mgr,
-		bot:     b,
-		mux:     mux,
+func New(log *lgr.Log, service Service, mgr *session.Manager, b *bot.Bot, mux *bot.Mux, pageSize int) *Handle {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
 	}
+	h := &Handle{
+		log:      log,
+		service:  service,
+		mgr:      mgr,
+		bot:      b,
+		mux:      mux,
+		pageSize: pageSize,
+	}
+	h.fsm = bot.NewFSM(conversation{}, h.callback(textDefaultMessage, lvlStart))
+	return h
 }
 
-func (h *Handle) send(user *session.User, configKey int, messageKey int) {
-	_, err := h.bot.Send(user.ID, configKey, messageKey)
-	if err != nil {
-		h.error(user, err)
+func (h *Handle) send(ctx context.Context, configKey int, messageKey string) {
+	user := session.FromContext(ctx)
+	if _, err := h.bot.Send(user.ID, user.Language, configKey, messageKey); err != nil {
+		h.error(ctx, err)
+	}
+}
+
+func (h *Handle) sendText(ctx context.Context, configKey int, text string) {
+	user := session.FromContext(ctx)
+	if _, err := h.bot.Reply(user.ID, bot.Reply{Level: configKey, Lang: user.Language, Text: text}); err != nil {
+		h.error(ctx, err)
+	}
+}
+
+func (h *Handle) sendMarkup(ctx context.Context, text string, markup bot.Markup) {
+	user := session.FromContext(ctx)
+	if _, err := h.bot.Reply(user.ID, bot.Reply{Level: lvlEmpty, Lang: user.Language, Text: text, Markup: &markup}); err != nil {
+		h.error(ctx, err)
+	}
+}
+
+// show edits the message with the pressed button in place when the request
+// came from a button and sends a new message otherwise.
+func (h *Handle) show(ctx context.Context, r *bot.Request, reply bot.Reply) {
+	user := session.FromContext(ctx)
+	reply.Lang = user.Language
+	if r.MessageID != 0 {
+		err := h.bot.Edit(user.ID, r.MessageID, reply)
+		if err == nil {
+			return
+		}
+		h.logger(ctx).Debug("editing message failed, sending a new one", slog.Any("error", err))
 	}
+	if _, err := h.bot.Reply(user.ID, reply); err != nil {
+		h.error(ctx, err)
+	}
+}
+
+// text returns the text under key in the language of the user.
+func (h *Handle) text(ctx context.Context, key string) string {
+	return h.bot.Config.Text(session.FromContext(ctx).Language, key)
+}
+
+func (h *Handle) render(ctx context.Context, key string, args i18n.Args) string {
+	return h.bot.Config.Render(session.FromContext(ctx).Language, key, args)
+}
 
+// logger returns the logger carrying the attributes of the current request.
+func (h *Handle) logger(ctx context.Context) *lgr.Log {
+	if log := bot.Logger(ctx); log != nil {
+		return log
+	}
+	return h.log
 }
 
-func (h *Handle) errorCode(code int, user *session.User, err error) {
+func (h *Handle) errorCode(ctx context.Context, code int, err error) {
 	err = h.log.ErrorCode(code, err)
-	log := h.log.With(
-		slog.Any("error", err),
-		slog.Int64("user_id", user.ID),
-		slog.String("username", user.Name),
-		slog.String("request", user.Request),
-	)
+	log := h.logger(ctx).With(slog.Any("error", err))
 	log.Error("error building message")
-	h.bot.Config.SetReplyMessage(
-		textError,
-		fmt.Sprintf("В работе бота возникла ошибка. Код %03o\nПопробуйте снова позже или же обратитесь к %s за помощью", code, admin))
-	if _, err = h.bot.Send(user.ID, lvlEmpty, textError); err != nil {
+	key, args := textError, i18n.Args{"code": fmt.Sprintf("%03o", code)}
+	if h.support != "" {
+		key, args["support"] = textErrorSupport, format.Escape(h.support)
+	}
+	text := h.render(ctx, key, args)
+	user := session.FromContext(ctx)
+	if _, err = h.bot.Reply(user.ID, bot.Reply{Level: lvlEmpty, Lang: user.Language, Text: text}); err != nil {
 		log.Errorf("error sending message", err)
 	}
 }
 
-func (h *Handle) error(user *session.User, err error) {
+func (h *Handle) error(ctx context.Context, err error) {
+	h.logger(ctx).Errorf("error handling request", err)
+}
+
+// session is the middleware resolving the user the request comes from. It
+// loads the user's session before the handler runs and saves it afterwards.
+func (h *Handle) session(next bot.Handler) bot.Handler {
+	return bot.HandlerFunc(func(ctx context.Context, r *bot.Request) {
+		user, err := h.loadUser(ctx, r)
+		if err != nil {
+			h.error(ctx, err)
+			return
+		}
+		// Banned users get no reply, their session only remembers the ban.
+		if user.Banned {
+			h.logger(ctx).Debug("request from banned user ignored")
+		} else {
+			ctx = session.WithUser(ctx, user)
+			ctx = bot.WithLogger(ctx, h.logger(ctx).With(slog.String("state", user.State)))
+			next.ServeBot(ctx, r)
+		}
+		if err = h.mgr.Save(ctx, user); err != nil {
+			h.error(ctx, fmt.Errorf("error saving session: %w", err))
+		}
+	})
+}
+
+// conversation keeps the state of the bot.FSM in the session of the user.
+type conversation struct{}
+
+func (conversation) State(ctx context.Context) (string, time.Time) {
+	user := session.FromContext(ctx)
 	if user == nil {
-		h.log.Errorf("error sending message", err)
-	} else {
-		h.log.Error("error building message",
-			slog.Any("error", err),
-			slog.Int64("user_id", user.ID),
-			slog.String("username", user.Name),
-			slog.String("request", user.Request),
-		)
+		return "", time.Time{}
+	}
+	return user.State, user.StateAt
+}
+
+func (conversation) SetState(ctx context.Context, name string) {
+	if user := session.FromContext(ctx); user != nil {
+		user.State = name
+		user.StateAt = time.Now()
 	}
 }
 
-func (h *Handle) getUser(ctx context.Context, r *bot.Request) (*session.User, error) {
-	user := h.mgr.GetUser(r.Chat.ID)
+func (h *Handle) loadUser(ctx context.Context, r *bot.Request) (*session.User, error) {
+	user, err := h.mgr.GetUser(ctx, r.Chat.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting session: %w", err)
+	}
 	if user == nil {
-		log := h.log.With(
-			slog.Int64("user_id", r.Chat.ID),
-			slog.String("username", r.Chat.UserName),
-		)
+		log := h.logger(ctx)
 		log.Debug("not such user, searching in db")
 		userData, err := h.service.GetUser(ctx, r.Chat.ID)
 		if err != nil {
@@ -108,11 +228,20 @@ func (h *Handle) getUser(ctx context.Context, r *bot.Request) (*session.User, er
 					ID:       r.Chat.ID,
 					Name:     r.Chat.UserName,
 					Password: hashedPass,
+					Language: h.bot.Config.Language(r.Language),
 				}
 				err = h.service.AddUser(ctx, userData)
 				if err != nil {
 					return nil, fmt.Errorf("error adding user to db: %w", err)
 				}
+				err = h.service.AddWishlist(ctx, &entity.Wishlist{
+					ID:       random.String(16),
+					UserID:   userData.ID,
+					Password: hashedPass,
+				})
+				if err != nil {
+					return nil, fmt.Errorf("error adding wishlist to db: %w", err)
+				}
 			} else {
 				return nil, fmt.Errorf("error getting user from db: %w", err)
 			}
@@ -122,8 +251,20 @@ func (h *Handle) getUser(ctx context.Context, r *bot.Request) (*session.User, er
 				return nil, fmt.Errorf("error updating user in db: %w", err)
 			}
 		}
+		// Users added before languages were stored get one from their client.
+		if userData.Language == "" {
+			userData.Language = h.bot.Config.Language(r.Language)
+			if err = h.service.SetLanguage(ctx, userData.ID, userData.Language); err != nil {
+				return nil, fmt.Errorf("error updating user in db: %w", err)
+			}
+		}
 		log.Debug("adding user in session manager")
-		user = h.mgr.AddUser(r.Chat.ID, r.Chat.UserName)
+		user, err = h.mgr.AddUser(ctx, r.Chat.ID, r.Chat.UserName)
+		if err != nil {
+			return nil, fmt.Errorf("error adding session: %w", err)
+		}
+		user.Language = userData.Language
+		user.Banned = userData.Banned
 	}
 	return user, nil
 }
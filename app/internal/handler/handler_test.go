@@ -0,0 +1,101 @@
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/bot"
+	"github.com/eugene-static/wishlist_bot/app/internal/handler"
+	"github.com/eugene-static/wishlist_bot/app/internal/service"
+	"github.com/eugene-static/wishlist_bot/app/internal/session"
+	"github.com/eugene-static/wishlist_bot/app/internal/storage"
+	"github.com/eugene-static/wishlist_bot/app/internal/telegramtest"
+	"github.com/eugene-static/wishlist_bot/app/lib/lgr"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// replyTimeout is generous, as every new user costs a bcrypt hash, which is
+// slow under the race detector.
+const replyTimeout = 30 * time.Second
+
+// TestConcurrentChats has many users fill their lists at the same time and
+// checks that nobody sees the wishes of someone else.
+func TestConcurrentChats(t *testing.T) {
+	api := telegramtest.NewServer()
+	defer api.Close()
+	botapi, err := tgbotapi.NewBotAPIWithAPIEndpoint(telegramtest.Token, api.Endpoint())
+	if err != nil {
+		t.Fatalf("NewBotAPI: %v", err)
+	}
+	log := lgr.New(io.Discard, "")
+	b := bot.NewBot(botapi)
+	mux := bot.NewBotMux()
+	h := handler.New(log, service.New(storage.NewMemory()), session.New(session.NewMemory(0)), b, mux, 0)
+	h.Register()
+	if err = h.SetConfig(""); err != nil {
+		t.Fatalf("SetConfig: %v", err)
+	}
+	h.SetErrors()
+	updates := botapi.GetUpdatesChan(tgbotapi.UpdateConfig{Timeout: 1})
+	done := make(chan struct{})
+	go func() {
+		bot.NewServer(log, b, mux, 8, 0).Listen(context.Background(), updates)
+		close(done)
+	}()
+	defer func() {
+		botapi.StopReceivingUpdates()
+		<-done
+	}()
+
+	var wg sync.WaitGroup
+	for id := int64(1); id <= 10; id++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			name := fmt.Sprintf("user%d", id)
+			send := func(text string) (telegramtest.Message, bool) {
+				api.SendText(id, name, text)
+				m, ok := api.Next(id, replyTimeout)
+				if !ok {
+					t.Errorf("%s: no reply to %q", name, text)
+				}
+				return m, ok
+			}
+			m, ok := send("/show_me")
+			if !ok {
+				return
+			}
+			data, ok := m.Button("Мой вишлист")
+			if !ok {
+				t.Errorf("%s: no button for the default list in %q", name, m.Text)
+				return
+			}
+			api.Press(m, name, data)
+			if _, ok = api.Next(id, replyTimeout); !ok {
+				t.Errorf("%s: no reply to opening the list", name)
+				return
+			}
+			for i := 1; i <= 3; i++ {
+				if _, ok = send("/add"); !ok {
+					return
+				}
+				if m, ok = send(fmt.Sprintf("wish-of-%d-%d 5$ https://example.com !2", id, i)); !ok {
+					return
+				}
+			}
+			// The list is shown after each wish added.
+			if got := strings.Count(m.Text, "wish-of-"); got != 3 {
+				t.Errorf("%s: list has %d wishes, want 3:\n%s", name, got, m.Text)
+			}
+			if got := strings.Count(m.Text, fmt.Sprintf("wish-of-%d-", id)); got != 3 {
+				t.Errorf("%s: list has %d own wishes, want 3:\n%s", name, got, m.Text)
+			}
+		}(id)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"context"
+	"slices"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/bot"
+	"github.com/eugene-static/wishlist_bot/app/internal/session"
+)
+
+func (h *Handle) chooseLanguage(ctx context.Context, r *bot.Request) {
+	var rows [][]bot.Button
+	for _, lang := range h.bot.Config.Languages() {
+		name := h.bot.Config.Text(lang, languageName)
+		rows = append(rows, bot.NewRow(bot.NewButton(name, bot.Fill(actionSetLang, lang))))
+	}
+	rows = append(rows, bot.NewRow(bot.NewButton(h.text(ctx, buttonBack), actionBack)))
+	markup := bot.NewMarkup(rows...)
+	h.show(ctx, r, bot.Reply{Level: lvlEmpty, Text: h.text(ctx, textChooseLanguage), Markup: &markup})
+}
+
+func (h *Handle) setLanguage(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	lang := r.Param("lang")
+	if !slices.Contains(h.bot.Config.Languages(), lang) {
+		h.send(ctx, lvlEmpty, textWrongRequest)
+		return
+	}
+	if err := h.service.SetLanguage(ctx, user.ID, lang); err != nil {
+		h.errorCode(ctx, errLanguage, err)
+		return
+	}
+	user.Language = lang
+	h.navigate(textGreetings, lvlStart)(ctx, r)
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/bot"
+	"github.com/eugene-static/wishlist_bot/app/internal/entity"
+	"github.com/eugene-static/wishlist_bot/app/internal/session"
+	"github.com/eugene-static/wishlist_bot/app/lib/format"
+	"github.com/eugene-static/wishlist_bot/app/lib/i18n"
+	"github.com/eugene-static/wishlist_bot/app/lib/random"
+)
+
+func (h *Handle) showMe(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	lists, err := h.service.GetWishlists(ctx, user.ID)
+	if err != nil {
+		h.errorCode(ctx, errGetList, err)
+		return
+	}
+	var rows [][]bot.Button
+	for _, list := range lists {
+		name := h.listName(ctx, list)
+		if list.Hidden {
+			name = h.render(ctx, buttonHiddenList, i18n.Args{"name": name})
+		}
+		rows = append(rows, bot.NewRow(bot.NewButton(name, h.mux.Data(bot.Fill(actionOpenList, list.ID)))))
+	}
+	rows = append(rows,
+		bot.NewRow(bot.NewButton(h.text(ctx, buttonNewList), actionNewList)),
+		bot.NewRow(bot.NewButton(h.text(ctx, buttonBack), actionBack)))
+	markup := bot.NewMarkup(rows...)
+	h.show(ctx, r, bot.Reply{Level: lvlEmpty, Text: h.text(ctx, textChooseList), Markup: &markup})
+}
+
+func (h *Handle) openList(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	id := r.Param("id")
+	if id == "" {
+		id = user.ListID
+	}
+	list, ok := h.ownList(ctx, user, id)
+	if !ok {
+		return
+	}
+	if list.ID != user.ListID {
+		user.Page = 1
+	}
+	user.ListID = list.ID
+	user.IDList = nil
+	wishes, err := h.service.GetWishes(ctx, list.ID)
+	if err != nil {
+		h.errorCode(ctx, errGetList, err)
+		return
+	}
+	if wishes == nil {
+		h.show(ctx, r, bot.Reply{Level: lvlEmptyList, Text: h.text(ctx, textNoWishes)})
+		return
+	}
+	// Wishes are numbered across pages, so IDList holds the whole list.
+	user.IDList = make([]string, len(wishes))
+	for i, wish := range wishes {
+		user.IDList[i] = wish.ID
+	}
+	var text format.Builder
+	text.Bold(format.Text(h.listName(ctx, list))).Text(" · " + h.bot.Config.Plural(user.Language, textWishCount, len(wishes), nil) + "\n")
+	rendered := h.renderWishes(ctx, wishes, user.ID)
+	page, pages, from, to := paginate(lengths(rendered), h.pageSize, bot.MaxMessageLength-text.Len(), requestedPage(r, user.Page))
+	user.Page = page
+	text.Add(rendered[from:to]...)
+	markup := h.bot.Config.Markup(user.Language, lvlMe)
+	if row := h.pageRow(ctx, actionListPage, list.ID, page, pages); row != nil {
+		markup.InlineKeyboard = append([][]bot.Button{row}, markup.InlineKeyboard...)
+	}
+	h.show(ctx, r, bot.Reply{Level: lvlMe, Text: text.String(), Markup: &markup})
+}
+
+// listName returns the name of list, or the default one in the language of
+// the user for the list every user starts with.
+func (h *Handle) listName(ctx context.Context, list *entity.Wishlist) string {
+	if list.Name == "" {
+		return h.text(ctx, defaultListName)
+	}
+	return list.Name
+}
+
+// ownList loads a wishlist and checks that it belongs to user, replying with
+// an error message otherwise.
+func (h *Handle) ownList(ctx context.Context, user *session.User, id string) (*entity.Wishlist, bool) {
+	if id == "" {
+		h.send(ctx, lvlEmpty, textWrongRequest)
+		return nil, false
+	}
+	list, err := h.service.GetWishlist(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.send(ctx, lvlEmpty, textWrongRequest)
+			return nil, false
+		}
+		h.errorCode(ctx, errGetList, err)
+		return nil, false
+	}
+	if list.UserID != user.ID {
+		h.send(ctx, lvlEmpty, textWrongRequest)
+		return nil, false
+	}
+	return list, true
+}
+
+func (h *Handle) newList(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	name := strings.TrimSpace(r.Data)
+	hashedPass, err := hash(user.Name)
+	if err != nil {
+		h.errorCode(ctx, errList, err)
+		return
+	}
+	list := &entity.Wishlist{
+		ID:       random.String(16),
+		UserID:   user.ID,
+		Name:     name,
+		Password: hashedPass,
+	}
+	if err = h.service.AddWishlist(ctx, list); err != nil {
+		h.errorCode(ctx, errList, err)
+		return
+	}
+	user.ListID = list.ID
+	r.Params = nil
+	h.fsm.Finish(ctx)
+	h.openList(ctx, r)
+}
+
+func (h *Handle) renameList(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	name := strings.TrimSpace(r.Data)
+	list, ok := h.ownList(ctx, user, user.ListID)
+	if !ok {
+		return
+	}
+	list.Name = name
+	if err := h.service.UpdateWishlist(ctx, list); err != nil {
+		h.errorCode(ctx, errList, err)
+		return
+	}
+	h.fsm.Finish(ctx)
+	h.openList(ctx, r)
+}
+
+func (h *Handle) hideList(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	list, ok := h.ownList(ctx, user, user.ListID)
+	if !ok {
+		return
+	}
+	list.Hidden = !list.Hidden
+	if err := h.service.UpdateWishlist(ctx, list); err != nil {
+		h.errorCode(ctx, errList, err)
+		return
+	}
+	if list.Hidden {
+		h.send(ctx, lvlService, textListHidden)
+	} else {
+		h.send(ctx, lvlService, textListVisible)
+	}
+}
+
+func (h *Handle) deleteList(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	if _, err := h.service.DeleteWishlist(ctx, user.ID, user.ListID); err != nil {
+		h.errorCode(ctx, errList, err)
+		return
+	}
+	user.ListID = ""
+	user.IDList = nil
+	h.showMe(ctx, r)
+}
+
+func (h *Handle) userLists(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	if user.Viewing == 0 {
+		h.send(ctx, lvlUser, textWrongRequest)
+		return
+	}
+	lists, err := h.service.GetWishlists(ctx, user.Viewing)
+	if err != nil {
+		h.errorCode(ctx, errGetList, err)
+		return
+	}
+	var rows [][]bot.Button
+	for _, list := range lists {
+		if !list.Hidden {
+			rows = append(rows, bot.NewRow(bot.NewButton(h.listName(ctx, list), h.mux.Data(bot.Fill(actionView, list.ID)))))
+		}
+	}
+	if rows == nil {
+		h.send(ctx, lvlUser, textUserNotFound)
+		return
+	}
+	rows = append(rows, bot.NewRow(bot.NewButton(h.text(ctx, buttonBack), actionBack)))
+	markup := bot.NewMarkup(rows...)
+	h.show(ctx, r, bot.Reply{Level: lvlEmpty, Text: h.text(ctx, textChooseUserList), Markup: &markup})
+}
+
+// unlock makes owner the user being viewed and remembers which of the lists
+// of owner password opens.
+func (h *Handle) unlock(ctx context.Context, user *session.User, owner int64, password []byte) error {
+	lists, err := h.service.GetWishlists(ctx, owner)
+	if err != nil {
+		return err
+	}
+	user.Viewing = owner
+	user.Unlocked = nil
+	for _, list := range lists {
+		if !list.Hidden && compare(list.Password, password) == nil {
+			user.Unlocked = append(user.Unlocked, list.ID)
+		}
+	}
+	return nil
+}
+
+func (h *Handle) viewList(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	list, err := h.service.GetWishlist(ctx, r.Param("id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.send(ctx, lvlUser, textWrongRequest)
+			return
+		}
+		h.errorCode(ctx, errGetList, err)
+		return
+	}
+	if list.UserID != user.Viewing || list.Hidden {
+		h.send(ctx, lvlUser, textWrongRequest)
+		return
+	}
+	if !slices.Contains(user.Unlocked, list.ID) {
+		h.send(ctx, lvlUser, textWrongPassword)
+		return
+	}
+	if list.ID != user.ViewingList {
+		user.ViewingPage = 1
+	}
+	user.ViewingList = list.ID
+	user.ViewingPage = requestedPage(r, user.ViewingPage)
+	h.showList(ctx, r, user)
+}
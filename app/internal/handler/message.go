@@ -4,184 +4,186 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/eugene-static/wishlist_bot/app/internal/bot"
 	"github.com/eugene-static/wishlist_bot/app/internal/entity"
-	"github.com/eugene-static/wishlist_bot/app/lib/random"
+	"github.com/eugene-static/wishlist_bot/app/internal/session"
+	"github.com/eugene-static/wishlist_bot/app/lib/format"
+	"github.com/eugene-static/wishlist_bot/app/lib/i18n"
 )
 
 func (h *Handle) start(ctx context.Context, r *bot.Request) {
-	user, err := h.getUser(ctx, r)
-	if err != nil {
-		h.error(nil, err)
-		return
-	}
-	h.log.Info("new user", slog.Int64("user_id", user.ID), slog.String("username", user.Name))
-	h.send(user, lvlStart, textGreetings)
-}
-
-func (h *Handle) message(ctx context.Context, r *bot.Request) {
-	user, err := h.getUser(ctx, r)
-	if err != nil {
-		h.error(nil, err)
+	if r.Args != "" {
+		h.openShared(ctx, r)
 		return
 	}
-	h.log.Debug("new message update",
-		slog.Int64("user_id", user.ID),
-		slog.String("username", user.Name),
-		slog.String("action", user.Action),
-	)
-	user.Request = r.Data
-	r.Data = user.Action
-	h.mux.ServeBot(ctx, r)
-}
-
-func (h *Handle) add(next bot.HandlerFunc) bot.HandlerFunc {
-	return func(ctx context.Context, r *bot.Request) {
-		user, err := h.getUser(ctx, r)
-		if err != nil {
-			h.error(nil, err)
-			return
-		}
-		if err = h.service.AddWish(ctx, &entity.Wish{
-			ID:      random.String(16),
-			Content: user.Request,
-			UserID:  user.ID,
-		}); err != nil {
-			h.errorCode(errAddWish, user, err)
-			return
-		}
-		next(ctx, r)
-	}
+	h.logger(ctx).Info("new user")
+	h.send(ctx, lvlStart, textGreetings)
 }
 
 func (h *Handle) delete(next bot.HandlerFunc) bot.HandlerFunc {
 	return func(ctx context.Context, r *bot.Request) {
-		user, err := h.getUser(ctx, r)
-		if err != nil {
-			h.error(nil, err)
-			return
-		}
-		nums := strings.Fields(user.Request)
-		if user.Request == deleteAllWishes {
-			nums = user.IDList
+		user := session.FromContext(ctx)
+		var ids []string
+		if r.Data == h.text(ctx, deleteAllWishes) {
+			ids = user.IDList
 		} else {
-			for i, num := range nums {
+			seen := make(map[int]bool)
+			for _, num := range strings.Fields(r.Data) {
 				index, err := strconv.Atoi(num)
 				if err != nil || index > len(user.IDList) || index <= 0 {
-					h.send(user, lvlEmpty, textWrongRequest)
+					h.send(ctx, lvlEmpty, textWrongRequest)
 					return
 				}
-				nums[i] = user.IDList[index-1]
+				if !seen[index] {
+					seen[index] = true
+					ids = append(ids, user.IDList[index-1])
+				}
 			}
 		}
-		if err = h.service.DeleteWishes(ctx, nums); err != nil {
-			h.errorCode(errDelWish, user, err)
+		deleted, err := h.service.DeleteWishes(ctx, user.ID, ids)
+		if err != nil {
+			h.errorCode(ctx, errDelWish, err)
 			return
 		}
+		if deleted < int64(len(ids)) {
+			h.send(ctx, lvlEmpty, textStaleWishes)
+		}
 		next(ctx, r)
 	}
 }
 
 func (h *Handle) password(ctx context.Context, r *bot.Request) {
-	user, err := h.getUser(ctx, r)
-	if err != nil {
-		h.error(nil, err)
-		return
+	user := session.FromContext(ctx)
+	password := r.Data
+	if password == h.text(ctx, deletePassword) {
+		password = user.Name
 	}
-	if user.Request == deletePassword {
-		user.Request = user.Name
-	} else if strings.ContainsRune(user.Request, ' ') {
-		h.send(user, lvlEmpty, textNoSpace)
+	list, ok := h.ownList(ctx, user, user.ListID)
+	if !ok {
 		return
 	}
-	hashedPass, err := hash(user.Request)
+	hashed, err := hash(password)
 	if err != nil {
-		h.errorCode(errChangePass, user, err)
+		h.errorCode(ctx, errChangePass, err)
 		return
 	}
-	if err = h.service.UpdateUser(ctx, user.ID, user.Name, hashedPass); err != nil {
-		h.errorCode(errChangePass, user, err)
+	list.Password = hashed
+	if err = h.service.UpdateWishlist(ctx, list); err != nil {
+		h.errorCode(ctx, errChangePass, err)
 		return
 	}
-	h.send(user, lvlService, textSuccess)
+	h.fsm.Finish(ctx)
+	h.send(ctx, lvlService, textSuccess)
 }
 
 func (h *Handle) showUser(ctx context.Context, r *bot.Request) {
-	user, err := h.getUser(ctx, r)
-	if err != nil {
-		h.error(nil, err)
-		return
-	}
+	user := session.FromContext(ctx)
 	level := lvlUser
-	req := strings.Fields(strings.TrimPrefix(user.Request, "@"))
+	req := strings.Fields(strings.TrimPrefix(r.Data, "@"))
 	switch len(req) {
 	case 1:
 		req = append(req, req[0])
 	case 2:
 		break
 	default:
-		h.send(user, level, textWrongRequest)
+		h.send(ctx, level, textWrongRequest)
 		return
 	}
 	username, password := req[0], []byte(req[1])
 	reqUser, err := h.service.GetUserByUsername(ctx, username)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			h.send(user, level, textUserNotFound)
+			h.send(ctx, level, textUserNotFound)
 			return
 		}
-		h.errorCode(errGetUser, user, err)
+		h.errorCode(ctx, errGetUser, err)
 		return
 	}
-	if compare(reqUser.Password, password) != nil {
-		h.send(user, level, textWrongPassword)
+	if err = h.unlock(ctx, user, reqUser.ID, password); err != nil {
+		h.errorCode(ctx, errGetList, err)
 		return
 	}
-	list, err := h.service.GetWishlistByID(ctx, reqUser.ID)
+	h.userLists(ctx, r)
+}
+
+func (h *Handle) showList(ctx context.Context, r *bot.Request, user *session.User) {
+	level := lvlUser
+	list, err := h.service.GetWishes(ctx, user.ViewingList)
 	if err != nil {
-		h.errorCode(errGetList, user, err)
+		h.errorCode(ctx, errGetList, err)
 		return
 	}
 	if list == nil {
-		h.send(user, level, textNoWishes)
+		h.show(ctx, r, bot.Reply{Level: level, Text: h.text(ctx, textNoWishes)})
 		return
 	}
-	var wishes strings.Builder
-	for i, wish := range list {
-		_, _ = wishes.WriteString(fmt.Sprintf("%d. %s\n", i+1, wish.Content))
-	}
-	h.bot.Config.SetReplyMessage(textWishList, wishes.String())
-	h.send(user, level, textWishList)
-}
-
-func (h *Handle) showMe(ctx context.Context, r *bot.Request) {
-	user, err := h.getUser(ctx, r)
-	if err != nil {
-		h.error(nil, err)
-		return
+	rendered := h.renderWishes(ctx, list, user.ID)
+	page, pages, from, to := paginate(lengths(rendered), h.pageSize, bot.MaxMessageLength, user.ViewingPage)
+	user.ViewingPage = page
+	var wishes format.Builder
+	wishes.Add(rendered[from:to]...)
+	var buttons []bot.Button
+	for i := from; i < to; i++ {
+		wish := list[i]
+		// Which wishes have buttons would tell owners what is reserved.
+		if user.Viewing == user.ID {
+			continue
+		}
+		switch wish.ReservedBy {
+		case 0:
+			buttons = append(buttons, bot.NewButton(h.render(ctx, buttonReserve, i18n.Args{"n": i + 1}), h.mux.Data(bot.Fill(actionReserve, wish.ID))))
+		case user.ID:
+			buttons = append(buttons, bot.NewButton(h.render(ctx, buttonUnreserve, i18n.Args{"n": i + 1}), h.mux.Data(bot.Fill(actionUnreserve, wish.ID))))
+		}
 	}
-	level := lvlEmptyList
-	list, err := h.service.GetWishlistByID(ctx, user.ID)
-	if err != nil {
-		h.errorCode(errGetList, user, err)
-		return
+	var rows [][]bot.Button
+	for len(buttons) > 0 {
+		n := min(len(buttons), reserveButtonsPerRow)
+		rows = append(rows, bot.NewRow(buttons[:n]...))
+		buttons = buttons[n:]
 	}
-	if list == nil {
-		h.send(user, level, textNoWishes)
-		return
+	if row := h.pageRow(ctx, actionViewPage, user.ViewingList, page, pages); row != nil {
+		rows = append(rows, row)
 	}
-	level = lvlMe
-	user.IDList = make([]string, len(list))
-	var wishes strings.Builder
-	for i, wish := range list {
-		user.IDList[i] = fmt.Sprintf("'%s'", wish.ID)
-		_, _ = wishes.WriteString(fmt.Sprintf("%d. %s\n", i+1, wish.Content))
+	rows = append(rows, bot.NewRow(bot.NewButton(h.text(ctx, buttonBack), actionUserLists)))
+	markup := bot.NewMarkup(rows...)
+	h.show(ctx, r, bot.Reply{Level: lvlEmpty, Text: wishes.String(), Markup: &markup})
+}
+
+func (h *Handle) reserve(reserve bool) bot.HandlerFunc {
+	return func(ctx context.Context, r *bot.Request) {
+		user := session.FromContext(ctx)
+		if user.ViewingList == "" || user.Viewing == user.ID {
+			h.send(ctx, lvlEmpty, textWrongRequest)
+			return
+		}
+		list, err := h.service.GetWishes(ctx, user.ViewingList)
+		if err != nil {
+			h.errorCode(ctx, errGetList, err)
+			return
+		}
+		id := r.Param("id")
+		if !slices.ContainsFunc(list, func(wish *entity.Wish) bool { return wish.ID == id }) {
+			h.send(ctx, lvlEmpty, textWrongRequest)
+			return
+		}
+		var ok bool
+		if reserve {
+			ok, err = h.service.ReserveWish(ctx, id, user.ID)
+		} else {
+			ok, err = h.service.UnreserveWish(ctx, id, user.ID)
+		}
+		if err != nil {
+			h.errorCode(ctx, errReserve, err)
+			return
+		}
+		if !ok && reserve {
+			r.Toast = h.text(ctx, textAlreadyReserved)
+		}
+		h.showList(ctx, r, user)
 	}
-	h.bot.Config.SetReplyMessage(textWishList, wishes.String())
-	h.send(user, level, textWishList)
 }
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/bot"
+	"github.com/eugene-static/wishlist_bot/app/lib/format"
+	"github.com/eugene-static/wishlist_bot/app/lib/i18n"
+)
+
+// paginate splits items of the given lengths into pages of at most size
+// items and limit characters, clamps page to them and returns it along with
+// the number of pages and the bounds of the page items. An item longer than
+// limit gets a page of its own.
+func paginate(lengths []int, size, limit, page int) (int, int, int, int) {
+	starts := []int{0}
+	count, length := 0, 0
+	for i, l := range lengths {
+		if count > 0 && (count == size || length+l > limit) {
+			starts = append(starts, i)
+			count, length = 0, 0
+		}
+		count++
+		length += l
+	}
+	pages := len(starts)
+	page = min(max(page, 1), pages)
+	from, to := starts[page-1], len(lengths)
+	if page < pages {
+		to = starts[page]
+	}
+	return page, pages, from, to
+}
+
+// lengths returns the lengths of parts to paginate them by.
+func lengths(parts []format.HTML) []int {
+	l := make([]int, len(parts))
+	for i, part := range parts {
+		l[i] = part.Len()
+	}
+	return l
+}
+
+// requestedPage returns the page number passed in the request or current.
+func requestedPage(r *bot.Request, current int) int {
+	if page, err := strconv.Atoi(r.Param("n")); err == nil {
+		return page
+	}
+	return current
+}
+
+// pageRow returns the buttons switching pages of the list id, or nil for a
+// list that fits on one page.
+func (h *Handle) pageRow(ctx context.Context, pattern string, id string, page, pages int) []bot.Button {
+	if pages <= 1 {
+		return nil
+	}
+	prev, next := page-1, page+1
+	if prev < 1 {
+		prev = pages
+	}
+	if next > pages {
+		next = 1
+	}
+	return bot.NewRow(
+		bot.NewButton(h.text(ctx, buttonPrevPage), h.mux.Data(bot.Fill(pattern, id, strconv.Itoa(prev)))),
+		bot.NewButton(h.render(ctx, buttonPage, i18n.Args{"page": page, "pages": pages}), actionNoop),
+		bot.NewButton(h.text(ctx, buttonNextPage), h.mux.Data(bot.Fill(pattern, id, strconv.Itoa(next)))),
+	)
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/bot"
+	"github.com/eugene-static/wishlist_bot/app/internal/session"
+	"github.com/eugene-static/wishlist_bot/app/lib/format"
+	"github.com/eugene-static/wishlist_bot/app/lib/i18n"
+	"github.com/eugene-static/wishlist_bot/app/lib/random"
+)
+
+func (h *Handle) share(regenerate bool) bot.HandlerFunc {
+	return func(ctx context.Context, r *bot.Request) {
+		user := session.FromContext(ctx)
+		list, ok := h.ownList(ctx, user, user.ListID)
+		if !ok {
+			return
+		}
+		if list.ShareToken == "" || regenerate {
+			list.ShareToken = random.Token(shareTokenLength)
+			if err := h.service.UpdateWishlist(ctx, list); err != nil {
+				h.errorCode(ctx, errList, err)
+				return
+			}
+		}
+		link := fmt.Sprintf(deepLink, h.bot.Username(), list.ShareToken)
+		h.sendText(ctx, lvlShare, h.render(ctx, textShareLink, i18n.Args{"list": format.Style(format.Bold, format.Text(h.listName(ctx, list))), "link": format.Escape(link)}))
+	}
+}
+
+func (h *Handle) revokeShare(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	list, ok := h.ownList(ctx, user, user.ListID)
+	if !ok {
+		return
+	}
+	list.ShareToken = ""
+	if err := h.service.UpdateWishlist(ctx, list); err != nil {
+		h.errorCode(ctx, errList, err)
+		return
+	}
+	h.send(ctx, lvlService, textLinkRevoked)
+}
+
+// openShared opens the list behind the deep link token passed to /start.
+func (h *Handle) openShared(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	list, err := h.service.GetWishlistByToken(ctx, r.Args)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.send(ctx, lvlStart, textLinkInvalid)
+			return
+		}
+		h.errorCode(ctx, errGetList, err)
+		return
+	}
+	if list.UserID == user.ID {
+		r.Params = map[string]string{"id": list.ID}
+		h.openList(ctx, r)
+		return
+	}
+	if list.Hidden {
+		h.send(ctx, lvlStart, textLinkInvalid)
+		return
+	}
+	owner, err := h.service.GetUser(ctx, list.UserID)
+	if err != nil {
+		h.errorCode(ctx, errGetUser, err)
+		return
+	}
+	if err = h.unlock(ctx, user, list.UserID, []byte(owner.Name)); err != nil {
+		h.errorCode(ctx, errGetList, err)
+		return
+	}
+	if !slices.Contains(user.Unlocked, list.ID) {
+		user.SharedList = list.ID
+		if err = h.fsm.Enter(ctx, r, stateSharePwd); err != nil {
+			h.error(ctx, err)
+		}
+		return
+	}
+	user.ViewingList = list.ID
+	user.ViewingPage = 1
+	h.showList(ctx, r, user)
+}
+
+func (h *Handle) sharedPassword(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	list, err := h.service.GetWishlist(ctx, user.SharedList)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.send(ctx, lvlStart, textLinkInvalid)
+			return
+		}
+		h.errorCode(ctx, errGetList, err)
+		return
+	}
+	if err = h.unlock(ctx, user, list.UserID, []byte(r.Data)); err != nil {
+		h.errorCode(ctx, errGetList, err)
+		return
+	}
+	if !slices.Contains(user.Unlocked, list.ID) {
+		h.send(ctx, lvlUser, textWrongPassword)
+		return
+	}
+	h.fsm.Finish(ctx)
+	user.SharedList = ""
+	user.ViewingList = list.ID
+	user.ViewingPage = 1
+	h.showList(ctx, r, user)
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/bot"
+	"github.com/eugene-static/wishlist_bot/app/internal/session"
+	"github.com/eugene-static/wishlist_bot/app/lib/i18n"
+	"github.com/eugene-static/wishlist_bot/app/lib/random"
+)
+
+var errInvalidInput = errors.New("invalid input")
+
+// wishSteps are the optional states of the add wish flow in the order they are asked.
+var wishSteps = []string{stateWishPrice, stateWishLink, stateWishPriority}
+
+func notEmpty(_ context.Context, r *bot.Request) error {
+	if strings.TrimSpace(r.Data) == "" {
+		return errInvalidInput
+	}
+	return nil
+}
+
+// skippable lets the user skip an optional step with the skip button.
+func skippable(validate func(context.Context, *bot.Request) error) func(context.Context, *bot.Request) error {
+	return func(ctx context.Context, r *bot.Request) error {
+		if r.Data == actionSkip {
+			return nil
+		}
+		return validate(ctx, r)
+	}
+}
+
+func validPrice(_ context.Context, r *bot.Request) error {
+	fields := strings.Fields(r.Data)
+	switch len(fields) {
+	case 1:
+		fields = append(fields, "")
+	case 2:
+	default:
+		return errInvalidInput
+	}
+	if _, currency, _ := parsePrice(fields[0], fields[1]); currency == "" {
+		return errInvalidInput
+	}
+	return nil
+}
+
+func validLink(_ context.Context, r *bot.Request) error {
+	u, err := url.Parse(strings.TrimSpace(r.Data))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errInvalidInput
+	}
+	return nil
+}
+
+func validPriority(_ context.Context, r *bot.Request) error {
+	if _, ok := parsePriority(r.Data); !ok {
+		return errInvalidInput
+	}
+	return nil
+}
+
+func (h *Handle) validPassword(ctx context.Context, r *bot.Request) error {
+	if r.Data != h.text(ctx, deletePassword) && (r.Data == "" || strings.ContainsRune(r.Data, ' ')) {
+		return errInvalidInput
+	}
+	return nil
+}
+
+func validListName(_ context.Context, r *bot.Request) error {
+	name := strings.TrimSpace(r.Data)
+	if name == "" || utf8.RuneCountInString(name) > maxListNameLength {
+		return errInvalidInput
+	}
+	return nil
+}
+
+func parsePriority(text string) (int, bool) {
+	priority, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(text), "!"))
+	if err != nil || priority < 1 || priority > 5 {
+		return 0, false
+	}
+	return priority, true
+}
+
+func (h *Handle) addWish(ctx context.Context, r *bot.Request) {
+	user := session.FromContext(ctx)
+	if user.ListID == "" {
+		h.fsm.Finish(ctx)
+		h.send(ctx, lvlEmpty, textWrongRequest)
+		return
+	}
+	user.Draft = parseWish(r.Data)
+	h.nextWishStep(ctx, r, user)
+}
+
+func (h *Handle) wishPrice(ctx context.Context, r *bot.Request) {
+	user, ok := h.draft(ctx, r)
+	if !ok {
+		return
+	}
+	if r.Data != actionSkip {
+		fields := append(strings.Fields(r.Data), "")
+		user.Draft.Price, user.Draft.Currency, _ = parsePrice(fields[0], fields[1])
+	}
+	h.nextWishStep(ctx, r, user)
+}
+
+func (h *Handle) wishLink(ctx context.Context, r *bot.Request) {
+	user, ok := h.draft(ctx, r)
+	if !ok {
+		return
+	}
+	if r.Data != actionSkip {
+		user.Draft.Link = strings.TrimSpace(r.Data)
+	}
+	h.nextWishStep(ctx, r, user)
+}
+
+func (h *Handle) wishPriority(ctx context.Context, r *bot.Request) {
+	user, ok := h.draft(ctx, r)
+	if !ok {
+		return
+	}
+	if r.Data != actionSkip {
+		user.Draft.Priority, _ = parsePriority(r.Data)
+	}
+	h.nextWishStep(ctx, r, user)
+}
+
+func (h *Handle) priorityPrompt(ctx context.Context, r *bot.Request) {
+	buttons := make([]bot.Button, 5)
+	for i := range buttons {
+		buttons[i] = bot.NewButton(h.render(ctx, buttonPriority, i18n.Args{"n": i + 1}), strconv.Itoa(i+1))
+	}
+	h.sendMarkup(ctx, h.text(ctx, textWishPriority), bot.NewMarkup(
+		bot.NewRow(buttons...),
+		bot.NewRow(
+			bot.NewButton(h.text(ctx, buttonSkip), actionSkip),
+			bot.NewButton(h.text(ctx, buttonCancel), actionList))))
+}
+
+// draft returns the user with the wish being added, finishing the
+// conversation if the draft has been lost.
+func (h *Handle) draft(ctx context.Context, r *bot.Request) (*session.User, bool) {
+	user := session.FromContext(ctx)
+	if user.Draft == nil {
+		h.fsm.Finish(ctx)
+		h.send(ctx, lvlEmpty, textWrongRequest)
+		return nil, false
+	}
+	return user, true
+}
+
+// nextWishStep asks for the next detail of the draft that was not given in
+// the description, saving the wish once there is nothing left to ask.
+func (h *Handle) nextWishStep(ctx context.Context, r *bot.Request, user *session.User) {
+	wish := user.Draft
+	missing := map[string]bool{
+		stateWishPrice:    wish.Currency == "",
+		stateWishLink:     wish.Link == "",
+		stateWishPriority: wish.Priority == 0,
+	}
+	for _, step := range wishSteps[slices.Index(wishSteps, user.State)+1:] {
+		if missing[step] {
+			if err := h.fsm.Transition(ctx, r, step); err != nil {
+				h.error(ctx, err)
+			}
+			return
+		}
+	}
+	h.fsm.Finish(ctx)
+	user.Draft = nil
+	wish.ID = random.String(16)
+	wish.ListID = user.ListID
+	wish.UserID = user.ID
+	if err := h.service.AddWish(ctx, wish); err != nil {
+		h.errorCode(ctx, errAddWish, err)
+		return
+	}
+	// The new wish is the last one, paginate clamps this to its page.
+	user.Page = math.MaxInt
+	r.Params = nil
+	h.openList(ctx, r)
+}
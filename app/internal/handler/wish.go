@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/entity"
+	"github.com/eugene-static/wishlist_bot/app/lib/format"
+)
+
+const (
+	noteSeparator        = "//"
+	reserveButtonsPerRow = 5
+	// maxPrice bounds prices in whole currency units, far below where the
+	// price in cents would overflow.
+	maxPrice = 1e12
+)
+
+var (
+	priorityToken = regexp.MustCompile(`^!([1-5])$`)
+	quantityToken = regexp.MustCompile(`^[xх×]([1-9][0-9]{0,3})$`)
+	priceToken    = regexp.MustCompile(`^([^0-9]*?)([0-9]+(?:[.,][0-9]{1,2})?)([^0-9]*)$`)
+)
+
+// parseWish extracts optional structured fields from the text of a new wish:
+// the first http(s) link, a price with currency (e.g. 1500₽, $20, 35 EUR),
+// priority as !1..!5, quantity as x2 and a private note after "//".
+func parseWish(text string) *entity.Wish {
+	wish := &entity.Wish{}
+	if i := strings.Index(text, " "+noteSeparator); i >= 0 {
+		wish.Note = strings.TrimSpace(text[i+len(noteSeparator)+1:])
+		text = text[:i]
+	}
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		rest := fields[:0]
+		for i := 0; i < len(fields); i++ {
+			token := fields[i]
+			if wish.Link == "" && (strings.HasPrefix(token, "http://") || strings.HasPrefix(token, "https://")) {
+				wish.Link = token
+				continue
+			}
+			if m := priorityToken.FindStringSubmatch(token); m != nil && wish.Priority == 0 {
+				wish.Priority, _ = strconv.Atoi(m[1])
+				continue
+			}
+			if m := quantityToken.FindStringSubmatch(token); m != nil && wish.Quantity == 0 {
+				wish.Quantity, _ = strconv.Atoi(m[1])
+				continue
+			}
+			if wish.Currency == "" {
+				var next string
+				if i+1 < len(fields) {
+					next = fields[i+1]
+				}
+				if price, currency, used := parsePrice(token, next); currency != "" {
+					wish.Price, wish.Currency = price, currency
+					i += used
+					continue
+				}
+			}
+			rest = append(rest, token)
+		}
+		if len(rest) > 0 {
+			lines = append(lines, strings.Join(rest, " "))
+		}
+	}
+	wish.Content = strings.Join(lines, "\n")
+	return wish
+}
+
+// parsePrice recognises a price in token, taking the currency either from the
+// token itself or from next. used reports whether next was consumed.
+func parsePrice(token, next string) (int64, string, int) {
+	m := priceToken.FindStringSubmatch(token)
+	if m == nil {
+		return 0, "", 0
+	}
+	amount, err := strconv.ParseFloat(strings.Replace(m[2], ",", ".", 1), 64)
+	if err != nil || amount > maxPrice {
+		return 0, "", 0
+	}
+	price := int64(amount*100 + 0.5)
+	switch {
+	case m[1] != "" && m[3] == "":
+		if currency := format.Currency(m[1]); currency != "" {
+			return price, currency, 0
+		}
+	case m[1] == "" && m[3] != "":
+		if currency := format.Currency(m[3]); currency != "" {
+			return price, currency, 0
+		}
+	case m[1] == "" && m[3] == "":
+		if currency := format.Currency(next); currency != "" {
+			return price, currency, 1
+		}
+	}
+	return 0, "", 0
+}
+
+// renderWishes formats wishes for viewer, numbering them from 1.
+func (h *Handle) renderWishes(ctx context.Context, wishes []*entity.Wish, viewer int64) []format.HTML {
+	rendered := make([]format.HTML, len(wishes))
+	for i, wish := range wishes {
+		rendered[i] = h.renderWish(ctx, i+1, wish, viewer)
+	}
+	return rendered
+}
+
+// renderWish formats a wish for viewer. Reservations are never shown to the
+// owner of the wish so the surprise is kept.
+func (h *Handle) renderWish(ctx context.Context, num int, wish *entity.Wish, viewer int64) format.HTML {
+	var b format.Builder
+	owner := wish.UserID == viewer
+	content := format.Text(wish.Content)
+	switch {
+	case wish.Content == "" && wish.Link != "":
+		content = format.Link(wish.Link, format.Text(wish.Link))
+	case wish.Link != "":
+		content = format.Link(wish.Link, content)
+	}
+	if !owner && wish.ReservedBy != 0 && wish.ReservedBy != viewer {
+		content = format.Style(format.Strikethrough, content)
+	}
+	b.Text(fmt.Sprintf("%d. ", num)).Add(content)
+	var details []format.HTML
+	if wish.Currency != "" {
+		details = append(details, format.Style(format.Bold, format.Text(format.Price(wish.Price, wish.Currency))))
+	}
+	if wish.Quantity > 1 {
+		details = append(details, format.Text(fmt.Sprintf("×%d", wish.Quantity)))
+	}
+	if wish.Priority > 0 {
+		details = append(details, format.Text(strings.Repeat("★", wish.Priority)+strings.Repeat("☆", 5-wish.Priority)))
+	}
+	if !owner {
+		switch wish.ReservedBy {
+		case 0:
+		case viewer:
+			details = append(details, format.Text(h.text(ctx, labelReservedByYou)))
+		default:
+			details = append(details, format.Text(h.text(ctx, labelReserved)))
+		}
+	}
+	for i, detail := range details {
+		if i == 0 {
+			b.Text(" — ")
+		} else {
+			b.Text(", ")
+		}
+		b.Add(detail)
+	}
+	b.Text("\n")
+	if owner && wish.Note != "" {
+		b.Italic(format.Text("   " + wish.Note)).Text("\n")
+	}
+	return b.HTML()
+}
@@ -0,0 +1,36 @@
+package handler
+
+import "testing"
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		token, next string
+		price       int64
+		currency    string
+		used        int
+	}{
+		{"1500₽", "", 150000, "RUB", 0},
+		{"$20", "", 2000, "USD", 0},
+		{"35", "EUR", 3500, "EUR", 1},
+		{"12,5€", "", 1250, "EUR", 0},
+		{"1000000000000₽", "", 100000000000000, "RUB", 0},
+		{"1000000000001₽", "", 0, "", 0},
+		{"1000000000000000000₽", "", 0, "", 0},
+		{"99999999999999999999999", "USD", 0, "", 0},
+		{"15", "", 0, "", 0},
+	}
+	for _, tt := range tests {
+		price, currency, used := parsePrice(tt.token, tt.next)
+		if price != tt.price || currency != tt.currency || used != tt.used {
+			t.Errorf("parsePrice(%q, %q) = %d, %q, %d, want %d, %q, %d",
+				tt.token, tt.next, price, currency, used, tt.price, tt.currency, tt.used)
+		}
+	}
+}
+
+func TestParseWishHugePrice(t *testing.T) {
+	wish := parseWish("Yacht 1000000000000000000₽")
+	if wish.Price != 0 || wish.Currency != "" || wish.Content != "Yacht 1000000000000000000₽" {
+		t.Errorf("parseWish() = %+v, want the amount kept as text", wish)
+	}
+}
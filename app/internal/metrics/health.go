@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const pingTimeout = 2 * time.Second
+
+// Health reports whether the bot is alive and ready to handle updates.
+type Health struct {
+	ping func(ctx context.Context) error
+	// maxAge is how long ago updates may have last been received for the bot
+	// to be ready, 0 for no limit.
+	maxAge   time.Duration
+	received atomic.Int64
+}
+
+func NewHealth(ping func(ctx context.Context) error, maxAge time.Duration) *Health {
+	return &Health{ping: ping, maxAge: maxAge}
+}
+
+// Received records that updates were successfully requested from Telegram.
+func (h *Health) Received() {
+	h.received.Store(time.Now().UnixNano())
+}
+
+// Live checks the storage connection.
+func (h *Health) Live(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	if err := h.ping(ctx); err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+	return nil
+}
+
+// Ready checks the storage connection and that updates are being received.
+func (h *Health) Ready(ctx context.Context) error {
+	if err := h.Live(ctx); err != nil {
+		return err
+	}
+	received := h.received.Load()
+	if received == 0 {
+		return errors.New("updates: not received yet")
+	}
+	if age := time.Since(time.Unix(0, received)); h.maxAge > 0 && age > h.maxAge {
+		return fmt.Errorf("updates: last received %s ago", age.Round(time.Second))
+	}
+	return nil
+}
+
+// Handler serves /metrics, /healthz and /readyz.
+func (m *Metrics) Handler(h *Health) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	mux.Handle("/healthz", check(h.Live))
+	mux.Handle("/readyz", check(h.Ready))
+	return mux
+}
+
+func check(fn func(ctx context.Context) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	}
+}
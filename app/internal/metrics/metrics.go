@@ -0,0 +1,126 @@
+// Package metrics exposes Prometheus metrics of the bot and its health.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/bot"
+	"github.com/eugene-static/wishlist_bot/app/internal/session"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const (
+	namespace = "wishlist"
+	// noRoute labels requests that never reached routing, e.g. rate limited ones.
+	noRoute      = "none"
+	countTimeout = time.Second
+)
+
+type Metrics struct {
+	registry        *prometheus.Registry
+	updates         *prometheus.CounterVec
+	handlerDuration *prometheus.HistogramVec
+	telegramErrors  *prometheus.CounterVec
+	queryDuration   *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "updates_total",
+			Help:      "Updates handled by type and route pattern.",
+		}, []string{"type", "route"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Time spent handling an update by route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route"}),
+		telegramErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "telegram_errors_total",
+			Help:      "Failed Telegram API requests by method and status code.",
+		}, []string{"method", "code"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_query_duration_seconds",
+			Help:      "Duration of storage queries.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"query"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.updates,
+		m.handlerDuration,
+		m.telegramErrors,
+		m.queryDuration,
+	)
+	return m
+}
+
+// Middleware counts the updates and times their handlers. It reads the route
+// once the request has been handled, so it may run before the mux routes it.
+func (m *Metrics) Middleware(next bot.Handler) bot.Handler {
+	return bot.HandlerFunc(func(ctx context.Context, r *bot.Request) {
+		start := time.Now()
+		next.ServeBot(ctx, r)
+		route := r.Route
+		if route == "" {
+			route = noRoute
+		}
+		kind := "message"
+		if r.CallbackID != "" {
+			kind = "callback"
+		}
+		m.updates.WithLabelValues(kind, route).Inc()
+		m.handlerDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Outbox reports the queue and the counters of outgoing messages.
+func (m *Metrics) Outbox(o *bot.Outbox) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "outbox_depth",
+			Help:      "Outgoing messages waiting for the rate limits.",
+		}, func() float64 { return float64(o.Stats().Depth) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "outbox_sent_total",
+			Help:      "Outgoing messages sent.",
+		}, func() float64 { return float64(o.Stats().Sent) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "outbox_retried_total",
+			Help:      "Retries of outgoing messages.",
+		}, func() float64 { return float64(o.Stats().Retried) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "outbox_dropped_total",
+			Help:      "Outgoing messages given up on.",
+		}, func() float64 { return float64(o.Stats().Dropped) }),
+	)
+}
+
+// Sessions reports the number of live sessions in mgr.
+func (m *Metrics) Sessions(mgr *session.Manager) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "Live user sessions.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+		defer cancel()
+		n, err := mgr.Count(ctx)
+		if err != nil {
+			return 0
+		}
+		return float64(n)
+	}))
+}
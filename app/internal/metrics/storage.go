@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/entity"
+	"github.com/eugene-static/wishlist_bot/app/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// instrumentedStorage times the queries of the storage it wraps.
+type instrumentedStorage struct {
+	storage.Storage
+	duration *prometheus.HistogramVec
+}
+
+// Storage wraps s to observe the duration of its queries.
+func (m *Metrics) Storage(s storage.Storage) storage.Storage {
+	return &instrumentedStorage{Storage: s, duration: m.queryDuration}
+}
+
+func (s *instrumentedStorage) observe(query string, start time.Time) {
+	s.duration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+func (s *instrumentedStorage) GetUserByID(ctx context.Context, id int64) (*entity.User, error) {
+	defer s.observe("GetUserByID", time.Now())
+	return s.Storage.GetUserByID(ctx, id)
+}
+
+func (s *instrumentedStorage) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	defer s.observe("GetUserByUsername", time.Now())
+	return s.Storage.GetUserByUsername(ctx, username)
+}
+
+func (s *instrumentedStorage) AddUser(ctx context.Context, user *entity.User) error {
+	defer s.observe("AddUser", time.Now())
+	return s.Storage.AddUser(ctx, user)
+}
+
+func (s *instrumentedStorage) UpdateUserPassword(ctx context.Context, id int64, new []byte) error {
+	defer s.observe("UpdateUserPassword", time.Now())
+	return s.Storage.UpdateUserPassword(ctx, id, new)
+}
+
+func (s *instrumentedStorage) UpdateUsername(ctx context.Context, id int64, username string) error {
+	defer s.observe("UpdateUsername", time.Now())
+	return s.Storage.UpdateUsername(ctx, id, username)
+}
+
+func (s *instrumentedStorage) UpdateUserLanguage(ctx context.Context, id int64, language string) error {
+	defer s.observe("UpdateUserLanguage", time.Now())
+	return s.Storage.UpdateUserLanguage(ctx, id, language)
+}
+
+func (s *instrumentedStorage) UpdateUserBanned(ctx context.Context, id int64, banned bool) error {
+	defer s.observe("UpdateUserBanned", time.Now())
+	return s.Storage.UpdateUserBanned(ctx, id, banned)
+}
+
+func (s *instrumentedStorage) GetUserIDs(ctx context.Context) ([]int64, error) {
+	defer s.observe("GetUserIDs", time.Now())
+	return s.Storage.GetUserIDs(ctx)
+}
+
+func (s *instrumentedStorage) Stats(ctx context.Context) (*entity.Stats, error) {
+	defer s.observe("Stats", time.Now())
+	return s.Storage.Stats(ctx)
+}
+
+func (s *instrumentedStorage) CreateWishlist(ctx context.Context, list *entity.Wishlist) error {
+	defer s.observe("CreateWishlist", time.Now())
+	return s.Storage.CreateWishlist(ctx, list)
+}
+
+func (s *instrumentedStorage) GetWishlist(ctx context.Context, id string) (*entity.Wishlist, error) {
+	defer s.observe("GetWishlist", time.Now())
+	return s.Storage.GetWishlist(ctx, id)
+}
+
+func (s *instrumentedStorage) GetWishlistByToken(ctx context.Context, token string) (*entity.Wishlist, error) {
+	defer s.observe("GetWishlistByToken", time.Now())
+	return s.Storage.GetWishlistByToken(ctx, token)
+}
+
+func (s *instrumentedStorage) GetWishlists(ctx context.Context, userID int64) ([]*entity.Wishlist, error) {
+	defer s.observe("GetWishlists", time.Now())
+	return s.Storage.GetWishlists(ctx, userID)
+}
+
+func (s *instrumentedStorage) UpdateWishlist(ctx context.Context, list *entity.Wishlist) error {
+	defer s.observe("UpdateWishlist", time.Now())
+	return s.Storage.UpdateWishlist(ctx, list)
+}
+
+func (s *instrumentedStorage) DeleteWishlist(ctx context.Context, userID int64, id string) (bool, error) {
+	defer s.observe("DeleteWishlist", time.Now())
+	return s.Storage.DeleteWishlist(ctx, userID, id)
+}
+
+func (s *instrumentedStorage) CreateWish(ctx context.Context, wish *entity.Wish) error {
+	defer s.observe("CreateWish", time.Now())
+	return s.Storage.CreateWish(ctx, wish)
+}
+
+func (s *instrumentedStorage) GetWishes(ctx context.Context, listID string) ([]*entity.Wish, error) {
+	defer s.observe("GetWishes", time.Now())
+	return s.Storage.GetWishes(ctx, listID)
+}
+
+func (s *instrumentedStorage) DeleteWishes(ctx context.Context, userID int64, ids []string) (int64, error) {
+	defer s.observe("DeleteWishes", time.Now())
+	return s.Storage.DeleteWishes(ctx, userID, ids)
+}
+
+func (s *instrumentedStorage) ReserveWish(ctx context.Context, wishID string, userID int64) (bool, error) {
+	defer s.observe("ReserveWish", time.Now())
+	return s.Storage.ReserveWish(ctx, wishID, userID)
+}
+
+func (s *instrumentedStorage) UnreserveWish(ctx context.Context, wishID string, userID int64) (bool, error) {
+	defer s.observe("UnreserveWish", time.Now())
+	return s.Storage.UnreserveWish(ctx, wishID, userID)
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// telegramClient counts failed Telegram API requests and records successful
+// getUpdates calls in the health.
+type telegramClient struct {
+	client tgbotapi.HTTPClient
+	errors *prometheus.CounterVec
+	health *Health
+}
+
+// Client wraps the HTTP client of the bot API.
+func (m *Metrics) Client(client tgbotapi.HTTPClient, health *Health) tgbotapi.HTTPClient {
+	return &telegramClient{client: client, errors: m.telegramErrors, health: health}
+}
+
+func (c *telegramClient) Do(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.errors.WithLabelValues(method, "network").Inc()
+		return resp, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		c.errors.WithLabelValues(method, strconv.Itoa(resp.StatusCode)).Inc()
+	} else if method == "getUpdates" {
+		c.health.Received()
+	}
+	return resp, nil
+}
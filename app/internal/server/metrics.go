@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/lib/config"
+)
+
+// minUpdatesAge is the least time without updates before the bot is reported
+// not ready when polling.
+const minUpdatesAge = 30 * time.Second
+
+// updatesAge returns how long the bot may go without receiving updates
+// before it is not ready. Webhook updates come only when there are any, so
+// they are not limited.
+func (s *Server) updatesAge() time.Duration {
+	if s.cfg.Bot.Mode == config.ModeWebhook {
+		return 0
+	}
+	return max(2*time.Duration(*s.cfg.Bot.UpdateTimeout)*time.Second, minUpdatesAge)
+}
+
+// serveMetrics serves handler on the metrics address if one is configured.
+func (s *Server) serveMetrics(handler http.Handler) (stopFunc, error) {
+	if s.cfg.Metrics.Listen == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	ln, err := net.Listen("tcp", s.cfg.Metrics.Listen)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: readHeaderTimeout}
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			s.log.Errorf("metrics server error", err)
+		}
+	}()
+	s.log.Info("serving metrics", slog.String("address", ln.Addr().String()))
+	return srv.Shutdown, nil
+}
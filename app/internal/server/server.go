@@ -2,7 +2,9 @@ package server
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,6 +12,7 @@ import (
 
 	"github.com/eugene-static/wishlist_bot/app/internal/bot"
 	"github.com/eugene-static/wishlist_bot/app/internal/handler"
+	"github.com/eugene-static/wishlist_bot/app/internal/metrics"
 	"github.com/eugene-static/wishlist_bot/app/internal/service"
 	"github.com/eugene-static/wishlist_bot/app/internal/session"
 	"github.com/eugene-static/wishlist_bot/app/internal/storage"
@@ -18,38 +21,78 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 type Server struct {
 	cfg *config.Config
 	log *lgr.Log
+	// logFile is the file the log is written to, nil when logging to stdout only.
+	logFile *lgr.File
 }
 
 func New(cfg *config.Config) *Server {
-	var output *os.File
-	if cfg.Logger.Internal {
-		output = os.Stdout
-	} else {
+	s := &Server{cfg: cfg}
+	var output io.Writer = os.Stdout
+	if !*cfg.Logger.Internal {
 		var err error
-		output, err = os.Open(cfg.Logger.ExternalPath)
+		s.logFile, err = lgr.OpenFile(cfg.Logger.ExternalPath, lgr.FileOptions{
+			MaxSize:  int64(cfg.Logger.MaxSize) << 20,
+			MaxAge:   time.Duration(cfg.Logger.MaxAge) * time.Hour,
+			Backups:  cfg.Logger.Backups,
+			Compress: cfg.Logger.Compress,
+		})
 		if err != nil {
 			panic(err)
 		}
-		defer output.Close()
-	}
-	return &Server{
-		cfg: cfg,
-		log: lgr.New(output, cfg.Logger.Env),
+		output = s.logFile
+		if cfg.Logger.Tee {
+			output = io.MultiWriter(os.Stdout, s.logFile)
+		}
 	}
+	s.log = lgr.New(output, cfg.Logger.Env)
+	return s
 }
 
+// Start runs the bot until SIGINT or SIGTERM. SIGHUP reopens the log file.
 func (s *Server) Start() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
+	if s.logFile != nil {
+		defer s.logFile.Close()
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go func() {
+			for range hup {
+				if err := s.logFile.Reopen(); err != nil {
+					s.log.Errorf("reopening log file error", err)
+				}
+			}
+		}()
+	}
+	s.Run(ctx)
+}
+
+// Run starts the bot and blocks until ctx is done, then shuts it down.
+func (s *Server) Run(ctx context.Context) {
 	appStorage, err := storage.New(ctx, &s.cfg.Storage)
 	if err != nil {
 		s.log.Errorf("storage initialization error", err)
 		return
 	}
-	botapi, err := tgbotapi.NewBotAPI(s.cfg.Bot.Token)
+	m := metrics.New()
+	health := metrics.NewHealth(appStorage.Ping, s.updatesAge())
+	appStorage = m.Storage(appStorage)
+	sessions, err := session.NewStore(ctx, &s.cfg.Session)
+	if err != nil {
+		s.log.Errorf("session store initialization error", err)
+		return
+	}
+	endpoint := s.cfg.Bot.APIEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+	botapi, err := tgbotapi.NewBotAPIWithClient(s.cfg.Bot.Token, endpoint, m.Client(&http.Client{}, health))
 	if err != nil {
 		s.log.Errorf("bot creating error", err)
 		return
@@ -57,31 +100,96 @@ func (s *Server) Start() {
 	botapi.Debug = s.cfg.Bot.DebugMode
 	mux := bot.NewBotMux()
 	b := bot.NewBot(botapi)
-	appHandler := handler.New(s.log, service.New(appStorage), session.New(), b, mux)
+	outboxCfg := &s.cfg.Bot.Outbox
+	// Messages waiting for the limits are given up once shutdown runs out of time.
+	sendCtx, cancelSends := context.WithCancel(context.Background())
+	defer cancelSends()
+	outbox := bot.NewOutbox(sendCtx, s.log, outboxCfg.Rate, outboxCfg.ChatRate, outboxCfg.QueueSize, outboxCfg.Retries)
+	b.UseOutbox(outbox)
+	m.Outbox(outbox)
+	mgr := session.New(sessions)
+	m.Sessions(mgr)
+	// Counting updates before the rest of the middleware also counts the
+	// ones it drops.
+	mux.Use(m.Middleware)
+	appHandler := handler.New(s.log, service.New(appStorage), mgr, b, mux, s.cfg.Bot.PageSize)
 	appHandler.Register()
-	appHandler.SetConfig()
+	if err = appHandler.SetConfig(s.cfg.Bot.Locales); err != nil {
+		s.log.Errorf("texts loading error", err)
+		return
+	}
 	appHandler.SetErrors()
+	appHandler.SetAdmins(s.cfg.Bot.Admins)
+	appHandler.SetSupport(s.cfg.Bot.Support)
 	s.log.Info("authorized", slog.String("admin", botapi.Self.String()))
-	go bot.NewServer(b, mux).Listen(ctx, botapi.GetUpdatesChan(tgbotapi.UpdateConfig{
-		Offset:  s.cfg.Bot.UpdateOffset,
-		Limit:   s.cfg.Bot.UpdateLimit,
-		Timeout: s.cfg.Bot.UpdateTimeout,
-	}))
-	<-ctx.Done()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	long := make(chan struct{}, 1)
+	stopMetrics, err := s.serveMetrics(m.Handler(health))
+	if err != nil {
+		s.log.Errorf("metrics server error", err)
+		return
+	}
+	updates, stopUpdates, err := s.updates(botapi)
+	if err != nil {
+		s.log.Errorf("receiving updates error", err)
+		stopMetrics(context.Background())
+		return
+	}
+	if s.cfg.Bot.Mode == config.ModeWebhook {
+		health.Received()
+	}
+	botServer := bot.NewServer(s.log, b, mux, s.cfg.Bot.Workers, s.cfg.Bot.QueueSize)
+	drained := make(chan struct{})
 	go func() {
-		botapi.StopReceivingUpdates()
-		if err = appStorage.Close(); err != nil {
-			s.log.Errorf("closing storage error", err)
-		}
-		long <- struct{}{}
+		// Updates in flight are still handled after the signal, so they must
+		// not see a cancelled context.
+		botServer.Listen(context.WithoutCancel(ctx), updates)
+		close(drained)
 	}()
+	<-ctx.Done()
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+	context.AfterFunc(ctx, cancelSends)
+	if err := stopUpdates(ctx); err != nil {
+		s.log.Errorf("stopping updates error", err)
+	}
+	var drainErr error
 	select {
+	case <-drained:
 	case <-ctx.Done():
-		s.log.Errorf("error during shutdown", ctx.Err())
-	case <-long:
-		s.log.Info("The app is shut down successfully")
+		drainErr = ctx.Err()
+	}
+	// Broadcasts keep sending after the update that started them is handled.
+	if drainErr == nil {
+		drainErr = appHandler.Wait(ctx)
+	}
+	// Resources are released even when handlers are still running, they
+	// fail instead of keeping connections open after the app is gone.
+	if err := stopMetrics(ctx); err != nil {
+		s.log.Errorf("stopping metrics server error", err)
+	}
+	if err = appStorage.Close(); err != nil {
+		s.log.Errorf("closing storage error", err)
+	}
+	if err = sessions.Close(); err != nil {
+		s.log.Errorf("closing session store error", err)
+	}
+	if drainErr != nil {
+		s.log.Errorf("error during shutdown", drainErr)
+		return
+	}
+	stats := outbox.Stats()
+	s.log.Info("The app is shut down successfully",
+		slog.Uint64("sent", stats.Sent),
+		slog.Uint64("retried", stats.Retried),
+		slog.Uint64("dropped", stats.Dropped),
+	)
+}
+
+// shutdownTimeout is how long the updates in flight may take to handle after
+// a signal. Polling stops only once the request in flight returns, so it
+// gets the update timeout on top.
+func (s *Server) shutdownTimeout() time.Duration {
+	if s.cfg.Bot.Mode == config.ModeWebhook {
+		return shutdownTimeout
 	}
+	return shutdownTimeout + time.Duration(*s.cfg.Bot.UpdateTimeout)*time.Second
 }
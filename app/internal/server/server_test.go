@@ -0,0 +1,338 @@
+package server_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/server"
+	"github.com/eugene-static/wishlist_bot/app/internal/session"
+	"github.com/eugene-static/wishlist_bot/app/internal/storage"
+	"github.com/eugene-static/wishlist_bot/app/internal/telegramtest"
+	"github.com/eugene-static/wishlist_bot/app/lib/config"
+)
+
+const (
+	replyTimeout = 5 * time.Second
+	// quietTimeout is how long the bot must stay silent for a message to count as ignored.
+	quietTimeout = 300 * time.Millisecond
+	pageSize     = 3
+	adminID      = 1
+)
+
+// start runs the bot with in-memory storage against a fake Bot API and
+// stops it when the test ends.
+func start(t *testing.T) *telegramtest.Server {
+	t.Helper()
+	api := telegramtest.NewServer()
+	internal, timeout := true, 0
+	cfg := &config.Config{
+		Storage: config.Storage{Driver: storage.DriverMemory},
+		Session: config.Session{Driver: session.DriverMemory},
+		Logger:  config.Logger{Internal: &internal},
+		Bot: config.Bot{
+			Token:       telegramtest.Token,
+			APIEndpoint: api.Endpoint(),
+			Mode:        config.ModePolling,
+			// The fake API holds getUpdates back by itself.
+			UpdateTimeout: &timeout,
+			PageSize:      pageSize,
+			Admins:        []int64{adminID},
+			// Scripted users reply instantly, far faster than real ones.
+			Outbox: config.Outbox{ChatRate: 6000},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.New(cfg).Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		api.Close()
+	})
+	return api
+}
+
+// User is a Telegram user chatting with the bot.
+type User struct {
+	t    *testing.T
+	api  *telegramtest.Server
+	ID   int64
+	Name string
+	// Last is the latest message the bot sent or edited for the user.
+	Last telegramtest.Message
+}
+
+func newUser(t *testing.T, api *telegramtest.Server, id int64, name string) *User {
+	return &User{t: t, api: api, ID: id, Name: name}
+}
+
+// Send sends text to the bot and waits for the reply.
+func (u *User) Send(text string) *User {
+	u.t.Helper()
+	u.api.SendText(u.ID, u.Name, text)
+	return u.Next()
+}
+
+// Press presses the button labelled label on the last message and waits for the reply.
+func (u *User) Press(label string) *User {
+	u.t.Helper()
+	data, ok := u.Last.Button(label)
+	if !ok {
+		u.t.Fatalf("no button %q in message %q", label, u.Last.Text)
+	}
+	id := u.api.Press(u.Last, u.Name, data)
+	u.Next()
+	if _, ok = u.api.Answer(id, replyTimeout); !ok {
+		u.t.Fatalf("callback query for %q was not answered", label)
+	}
+	return u
+}
+
+// Ignored sends text to the bot and checks that it does not reply.
+func (u *User) Ignored(text string) *User {
+	u.t.Helper()
+	u.api.SendText(u.ID, u.Name, text)
+	if m, ok := u.api.Next(u.ID, quietTimeout); ok {
+		u.t.Fatalf("bot replied %q to %q, want no reply", m.Text, text)
+	}
+	return u
+}
+
+// Next waits for the next message from the bot.
+func (u *User) Next() *User {
+	u.t.Helper()
+	m, ok := u.api.Next(u.ID, replyTimeout)
+	if !ok {
+		u.t.Fatalf("no reply from the bot after %q", u.Last.Text)
+	}
+	u.Last = m
+	return u
+}
+
+// Expect checks that the last message contains every one of texts.
+func (u *User) Expect(texts ...string) *User {
+	u.t.Helper()
+	for _, text := range texts {
+		if !strings.Contains(u.Last.Text, text) {
+			u.t.Fatalf("message %q does not contain %q", u.Last.Text, text)
+		}
+	}
+	return u
+}
+
+// Reject checks that the last message contains none of texts.
+func (u *User) Reject(texts ...string) *User {
+	u.t.Helper()
+	for _, text := range texts {
+		if strings.Contains(u.Last.Text, text) {
+			u.t.Fatalf("message %q contains %q", u.Last.Text, text)
+		}
+	}
+	return u
+}
+
+// NoButtons checks that the last message has none of the buttons labelled labels.
+func (u *User) NoButtons(labels ...string) *User {
+	u.t.Helper()
+	for _, label := range labels {
+		if _, ok := u.Last.Button(label); ok {
+			u.t.Fatalf("message %q has button %q", u.Last.Text, label)
+		}
+	}
+	return u
+}
+
+// TestAddListDeletePasswordLookup walks one user through adding, listing and
+// deleting wishes and protecting the list with a password, then has another
+// user look the list up.
+func TestAddListDeletePasswordLookup(t *testing.T) {
+	api := start(t)
+	alice := newUser(t, api, 100, "alice")
+	alice.Send("/start").Expect("чем займемся")
+	alice.Press("Мои вишлисты").Expect("Выбери вишлист")
+	alice.Press("Мой вишлист").Expect("Здесь нет ни одного желания")
+
+	alice.Press("Добавить").Expect("Введи описание")
+	alice.Send("Наушники https://example.com/item 12990₽ !4").Expect("Наушники", "990 ₽", "★★★★☆")
+	alice.Press("Добавить")
+	alice.Send("Книга").Expect("Сколько это стоит")
+	alice.Press("Пропустить").Expect("Пришли ссылку")
+	alice.Press("Пропустить").Expect("Насколько сильно")
+	alice.Press("2★").Expect("1. ", "Наушники", "2. ", "Книга", "★★☆☆☆")
+
+	alice.Press("Удалить").Expect("номера желаний")
+	alice.Send("1").Expect("1. ", "Книга").Reject("Наушники")
+
+	alice.Press("Пароль").Expect("Пароль необходим")
+	alice.Send("два слова").Expect("не должно содержаться пробелов")
+	alice.Send("secret").Expect("Успешно")
+
+	bob := newUser(t, api, 200, "bob")
+	bob.Send("/start")
+	bob.Press("Найти пользователя").Expect("Введи юзернейм")
+	bob.Send("@alice").Expect("Выбери вишлист")
+	bob.Press("Мой вишлист").Expect("Неверный пароль")
+	bob.Send("alice secret").Expect("Выбери вишлист")
+	bob.Press("Мой вишлист").Expect("1. ", "Книга").Reject("Наушники")
+	bob.Press("🎁 1").Expect("Книга", "дарю я")
+}
+
+// TestOwnLookup checks that owners looking their own list up cannot tell
+// which wishes are reserved.
+func TestOwnLookup(t *testing.T) {
+	api := start(t)
+	alice := newUser(t, api, 100, "alice")
+	alice.Send("/start")
+	alice.Press("Мои вишлисты")
+	alice.Press("Мой вишлист")
+	for _, name := range []string{"Чай", "Кофе"} {
+		alice.Press("Добавить")
+		alice.Send(name + " https://example.com 100₽ !3")
+	}
+
+	bob := newUser(t, api, 200, "bob")
+	bob.Send("/start")
+	bob.Press("Найти пользователя")
+	bob.Send("@alice")
+	bob.Press("Мой вишлист")
+	bob.Press("🎁 1").Expect("Чай", "дарю я")
+
+	alice.Send("/start")
+	alice.Press("Найти пользователя")
+	alice.Send("@alice")
+	alice.Press("Мой вишлист").Expect("Чай", "Кофе").Reject("занято", "дарю я", "<s>")
+	alice.NoButtons("🎁 1", "🎁 2", "↩️ 1", "↩️ 2")
+}
+
+// TestPagination fills a list past one page, pages through it and deletes a wish
+// by its number on another page, then has another user page through it too.
+func TestPagination(t *testing.T) {
+	api := start(t)
+	alice := newUser(t, api, 100, "alice")
+	alice.Send("/start")
+	alice.Press("Мои вишлисты")
+	alice.Press("Мой вишлист")
+	for _, name := range []string{"Первое", "Второе", "Третье", "Четвертое", "Пятое"} {
+		alice.Press("Добавить")
+		alice.Send(name + " https://example.com 100₽ !3")
+	}
+	alice.Expect("4. ", "Четвертое", "5. ", "Пятое").Reject("Третье")
+	alice.Press("«").Expect("1. ", "Первое", "3. ", "Третье").Reject("Четвертое")
+	alice.Press("»").Expect("4. ", "Четвертое")
+
+	alice.Press("Удалить")
+	alice.Send("2").Expect("4. ", "Пятое")
+	alice.Press("«").Expect("1. ", "Первое", "2. ", "Третье", "3. ", "Четвертое").Reject("Второе")
+
+	bob := newUser(t, api, 200, "bob")
+	bob.Send("/start")
+	bob.Press("Найти пользователя")
+	bob.Send("@alice")
+	bob.Press("Мой вишлист").Expect("Первое", "Четвертое").Reject("Пятое")
+	bob.Press("»").Expect("4. ", "Пятое")
+	bob.Press("🎁 4").Expect("Пятое", "дарю я")
+}
+
+// TestLongWishes checks that wishes too long to fit on one page by count are
+// spread over more pages.
+func TestLongWishes(t *testing.T) {
+	api := start(t)
+	alice := newUser(t, api, 100, "alice")
+	alice.Send("/start")
+	alice.Press("Мои вишлисты")
+	alice.Press("Мой вишлист")
+	for _, name := range []string{"Первое", "Второе", "Третье"} {
+		alice.Press("Добавить")
+		alice.Send(name + strings.Repeat(" очень длинное описание", 80) + " https://example.com 100₽ !3")
+	}
+	alice.Expect("3. ", "Третье").Reject("Второе")
+	alice.Press("«").Expect("1. ", "Первое", "2. ", "Второе").Reject("Третье")
+
+	bob := newUser(t, api, 200, "bob")
+	bob.Send("/start")
+	bob.Press("Найти пользователя")
+	bob.Send("@alice")
+	bob.Press("Мой вишлист").Expect("Первое", "Второе").Reject("Третье")
+	bob.Press("»").Expect("3. ", "Третье")
+}
+
+// TestEscaping checks that markup typed by users is shown as text.
+func TestEscaping(t *testing.T) {
+	api := start(t)
+	alice := newUser(t, api, 100, "alice")
+	alice.Send("/start")
+	alice.Press("Мои вишлисты")
+	alice.Press("Мой вишлист")
+	alice.Press("Добавить")
+	alice.Send(`<b>Чай</b> & "кофе" https://example.com/?a=1&b=2 100₽ !3 // <i>тсс</i>`).
+		Expect("&lt;b&gt;Чай&lt;/b&gt; &amp; &quot;кофе&quot;", `href="https://example.com/?a=1&amp;b=2"`, "&lt;i&gt;тсс&lt;/i&gt;").
+		Reject("<b>Чай")
+}
+
+// TestLanguage checks that the bot speaks the language of the Telegram client
+// and switches it on request.
+func TestLanguage(t *testing.T) {
+	api := start(t)
+	api.SetLanguage(300, "en-US")
+	carol := newUser(t, api, 300, "carol")
+	carol.Send("/start").Expect("what shall we do")
+	carol.Press("My wishlists")
+	carol.Press("My wishlist").Expect("There are no wishes here")
+	carol.Press("Add")
+	carol.Send("Tea 5$ https://example.com !2").Expect("Tea", "1 wish")
+
+	carol.Press("Back")
+	carol.Press("Back")
+	carol.Press("🌐 Language").Expect("Choose a language")
+	carol.Press("Deutsch").Expect("was machen wir")
+	carol.Press("Meine Wunschlisten")
+	carol.Press("Meine Wunschliste").Expect("Meine Wunschliste", "Tea", "1 Wunsch")
+	carol.Press("Hinzufügen")
+	carol.Send("Kaffee").Expect("Wie viel kostet es")
+	carol.Press("Überspringen")
+	carol.Press("Überspringen")
+	carol.Press("3★").Expect("Kaffee", "2 Wünsche")
+
+	carol.Send("/language")
+	carol.Press("Русский").Expect("чем займемся")
+	carol.Press("Мои вишлисты")
+	carol.Press("Мой вишлист").Expect("Мой вишлист", "2 желания")
+}
+
+// TestAdmin checks that admin commands are hidden from other users and lets the
+// admin inspect, ban and message users.
+func TestAdmin(t *testing.T) {
+	api := start(t)
+	api.SetLanguage(adminID, "en")
+	root := newUser(t, api, adminID, "root")
+	dave := newUser(t, api, 400, "dave")
+	dave.Send("/start")
+	dave.Ignored("/stats")
+	dave.Ignored("/ban root")
+
+	root.Send("/stats").Expect("Users: 2, banned: 0", "Wishlists: 2", "Active sessions: 2")
+	root.Send("/user @dave").Expect("ID: <code>400</code>", "@dave", "Status: active", "Wishlists: 1")
+	root.Send("/user").Expect("Usage")
+	root.Send("/user nobody").Expect("no wishlist")
+	root.Send("/ban root").Expect("Admins can't be banned")
+	root.Send("/ban 400").Expect("@dave (400) is banned")
+	dave.Ignored("/start")
+	root.Send("/stats").Expect("banned: 1")
+
+	root.Send("/broadcast Hi <all>").Expect("will be sent to 1 user:", "Hi &lt;all&gt;")
+	root.Press("Cancel").Expect("Broadcast cancelled")
+	root.Send("/unban @dave").Expect("@dave (400) is unbanned")
+	dave.Send("/start").Expect("чем займемся")
+	root.Send("/broadcast\nHello,\nworld").Expect("will be sent to 2 users:", "Hello,\nworld")
+	root.Press("Cancel").Expect("Broadcast cancelled")
+	root.Send("/broadcast Hi <all>").Expect("will be sent to 2 users:")
+	root.Press("Send").Expect("Sending the message to 2 users")
+	root.Next().Expect("Hi &lt;all&gt;")
+	root.Next().Expect("Broadcast finished: 2 delivered, 0 failed")
+	dave.Next().Expect("Hi &lt;all&gt;")
+}
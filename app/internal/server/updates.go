@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/lib/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+	readHeaderTimeout = 10 * time.Second
+)
+
+type stopFunc func(ctx context.Context) error
+
+func (s *Server) updates(botapi *tgbotapi.BotAPI) (tgbotapi.UpdatesChannel, stopFunc, error) {
+	switch s.cfg.Bot.Mode {
+	case "", config.ModePolling:
+		return s.polling(botapi)
+	case config.ModeWebhook:
+		return s.webhook(botapi)
+	default:
+		return nil, nil, fmt.Errorf("unknown bot mode %q", s.cfg.Bot.Mode)
+	}
+}
+
+func (s *Server) polling(botapi *tgbotapi.BotAPI) (tgbotapi.UpdatesChannel, stopFunc, error) {
+	// getUpdates is refused while a webhook is set, e.g. by an earlier run
+	// in webhook mode.
+	if _, err := botapi.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return nil, nil, fmt.Errorf("deleting webhook: %w", err)
+	}
+	updates := botapi.GetUpdatesChan(tgbotapi.UpdateConfig{
+		Offset:  s.cfg.Bot.UpdateOffset,
+		Limit:   s.cfg.Bot.UpdateLimit,
+		Timeout: *s.cfg.Bot.UpdateTimeout,
+	})
+	return updates, func(context.Context) error {
+		botapi.StopReceivingUpdates()
+		return nil
+	}, nil
+}
+
+func (s *Server) webhook(botapi *tgbotapi.BotAPI) (tgbotapi.UpdatesChannel, stopFunc, error) {
+	cfg := &s.cfg.Bot.Webhook
+	if cfg.URL == "" {
+		return nil, nil, errors.New("webhook url is not set")
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, nil, errors.New("webhook cert_file and key_file must be set together")
+	}
+	path := cfg.Path
+	if path == "" {
+		path = "/"
+	}
+	// Telegram is only pointed at the webhook once it can be served.
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, nil, err
+	}
+	params := tgbotapi.Params{"url": cfg.URL}
+	params.AddNonEmpty("secret_token", cfg.SecretToken)
+	if _, err = botapi.MakeRequest("setWebhook", params); err != nil {
+		ln.Close()
+		return nil, nil, fmt.Errorf("setting webhook: %w", err)
+	}
+	ch := make(chan tgbotapi.Update, botapi.Buffer)
+	mux := http.NewServeMux()
+	mux.Handle(path, webhookHandler(botapi, cfg.SecretToken, ch))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: readHeaderTimeout}
+	go func() {
+		var err error
+		if cfg.CertFile != "" {
+			err = srv.ServeTLS(ln, cfg.CertFile, cfg.KeyFile)
+		} else {
+			err = srv.Serve(ln)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.log.Errorf("webhook server error", err)
+		}
+	}()
+	s.log.Info("listening for webhook", slog.String("address", ln.Addr().String()), slog.String("path", path))
+	return ch, func(ctx context.Context) error {
+		if err := srv.Shutdown(ctx); err != nil {
+			return err
+		}
+		close(ch)
+		return nil
+	}, nil
+}
+
+func webhookHandler(botapi *tgbotapi.BotAPI, secret string, updates chan<- tgbotapi.Update) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(secretTokenHeader)
+		if secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		update, err := botapi.HandleUpdate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		select {
+		case updates <- *update:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+}
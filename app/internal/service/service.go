@@ -2,7 +2,6 @@ package service
 
 import (
 	"context"
-	"strings"
 
 	"github.com/eugene-static/wishlist_bot/app/internal/entity"
 )
@@ -13,17 +12,38 @@ type User interface {
 	AddUser(ctx context.Context, user *entity.User) error
 	UpdateUserPassword(ctx context.Context, id int64, new []byte) error
 	UpdateUsername(ctx context.Context, id int64, username string) error
+	UpdateUserLanguage(ctx context.Context, id int64, language string) error
+	UpdateUserBanned(ctx context.Context, id int64, banned bool) error
+	// GetUserIDs returns the IDs of the users who are not banned.
+	GetUserIDs(ctx context.Context) ([]int64, error)
+	Stats(ctx context.Context) (*entity.Stats, error)
+}
+
+type Wishlist interface {
+	CreateWishlist(ctx context.Context, list *entity.Wishlist) error
+	GetWishlist(ctx context.Context, id string) (*entity.Wishlist, error)
+	GetWishlistByToken(ctx context.Context, token string) (*entity.Wishlist, error)
+	GetWishlists(ctx context.Context, userID int64) ([]*entity.Wishlist, error)
+	UpdateWishlist(ctx context.Context, list *entity.Wishlist) error
+	DeleteWishlist(ctx context.Context, userID int64, id string) (bool, error)
 }
 
 type List interface {
 	CreateWish(ctx context.Context, wish *entity.Wish) error
-	GetWishes(ctx context.Context, id int64) ([]*entity.Wish, error)
-	DeleteWishes(ctx context.Context, id string) error
+	GetWishes(ctx context.Context, listID string) ([]*entity.Wish, error)
+	DeleteWishes(ctx context.Context, userID int64, ids []string) (int64, error)
+}
+
+type Reservation interface {
+	ReserveWish(ctx context.Context, wishID string, userID int64) (bool, error)
+	UnreserveWish(ctx context.Context, wishID string, userID int64) (bool, error)
 }
 
 type Storage interface {
 	User
+	Wishlist
 	List
+	Reservation
 }
 
 type Service struct {
@@ -53,18 +73,65 @@ func (s *Service) UpdateUser(ctx context.Context, id int64, username string, new
 	return s.storage.UpdateUserPassword(ctx, id, new)
 }
 
+func (s *Service) SetLanguage(ctx context.Context, id int64, language string) error {
+	return s.storage.UpdateUserLanguage(ctx, id, language)
+}
+
+func (s *Service) SetBanned(ctx context.Context, id int64, banned bool) error {
+	return s.storage.UpdateUserBanned(ctx, id, banned)
+}
+
+func (s *Service) GetUserIDs(ctx context.Context) ([]int64, error) {
+	return s.storage.GetUserIDs(ctx)
+}
+
+func (s *Service) Stats(ctx context.Context) (*entity.Stats, error) {
+	return s.storage.Stats(ctx)
+}
+
 func (s *Service) AddWish(ctx context.Context, wish *entity.Wish) error {
 	return s.storage.CreateWish(ctx, wish)
 }
 
-func (s *Service) GetWishlistByID(ctx context.Context, id int64) ([]*entity.Wish, error) {
-	return s.storage.GetWishes(ctx, id)
+func (s *Service) AddWishlist(ctx context.Context, list *entity.Wishlist) error {
+	return s.storage.CreateWishlist(ctx, list)
+}
+
+func (s *Service) GetWishlist(ctx context.Context, id string) (*entity.Wishlist, error) {
+	return s.storage.GetWishlist(ctx, id)
 }
 
-func (s *Service) DeleteWishes(ctx context.Context, ids []string) error {
-	if ids == nil {
-		return nil
+func (s *Service) GetWishlistByToken(ctx context.Context, token string) (*entity.Wishlist, error) {
+	return s.storage.GetWishlistByToken(ctx, token)
+}
+
+func (s *Service) GetWishlists(ctx context.Context, userID int64) ([]*entity.Wishlist, error) {
+	return s.storage.GetWishlists(ctx, userID)
+}
+
+func (s *Service) UpdateWishlist(ctx context.Context, list *entity.Wishlist) error {
+	return s.storage.UpdateWishlist(ctx, list)
+}
+
+func (s *Service) DeleteWishlist(ctx context.Context, userID int64, id string) (bool, error) {
+	return s.storage.DeleteWishlist(ctx, userID, id)
+}
+
+func (s *Service) GetWishes(ctx context.Context, listID string) ([]*entity.Wish, error) {
+	return s.storage.GetWishes(ctx, listID)
+}
+
+func (s *Service) DeleteWishes(ctx context.Context, userID int64, ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
 	}
-	idq := strings.Join(ids, ",")
-	return s.storage.DeleteWishes(ctx, idq)
+	return s.storage.DeleteWishes(ctx, userID, ids)
+}
+
+func (s *Service) ReserveWish(ctx context.Context, wishID string, userID int64) (bool, error) {
+	return s.storage.ReserveWish(ctx, wishID, userID)
+}
+
+func (s *Service) UnreserveWish(ctx context.Context, wishID string, userID int64) (bool, error) {
+	return s.storage.UnreserveWish(ctx, wishID, userID)
 }
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	user    *User
+	expires time.Time
+}
+
+type Memory struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	users map[int64]entry
+	done  chan struct{}
+	once  sync.Once
+}
+
+func NewMemory(ttl time.Duration) *Memory {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	m := &Memory{
+		ttl:   ttl,
+		users: make(map[int64]entry),
+		done:  make(chan struct{}),
+	}
+	go m.cleanup()
+	return m
+}
+
+func (m *Memory) cleanup() {
+	ticker := time.NewTicker(m.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for id, e := range m.users {
+				if now.After(e.expires) {
+					delete(m.users, id)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (m *Memory) Get(_ context.Context, id int64) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.users[id]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(e.expires) {
+		delete(m.users, id)
+		return nil, nil
+	}
+	e.expires = time.Now().Add(m.ttl)
+	m.users[id] = e
+	return e.user.clone(), nil
+}
+
+func (m *Memory) Save(_ context.Context, user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[user.ID] = entry{user: user.clone(), expires: time.Now().Add(m.ttl)}
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.users, id)
+	return nil
+}
+
+func (m *Memory) Count(_ context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for _, e := range m.users {
+		if !now.After(e.expires) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) Close() error {
+	m.once.Do(func() { close(m.done) })
+	return nil
+}
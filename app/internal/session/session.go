@@ -1,67 +1,106 @@
 package session
 
 import (
-	"sync"
+	"context"
+	"slices"
 	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/entity"
 )
 
-const t = 10 * time.Minute
+const DefaultTTL = 10 * time.Minute
+
+type Store interface {
+	// Get returns a copy of the live session of the user or nil if there is none.
+	Get(ctx context.Context, id int64) (*User, error)
+	// Save stores the session and extends its lifetime.
+	Save(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id int64) error
+	Count(ctx context.Context) (int, error)
+	Close() error
+}
 
 type Manager struct {
-	Users map[int64]*User
-	mu    sync.Mutex
+	store Store
 }
 
 type User struct {
-	ID      int64
-	Name    string
-	Request string
-	Action  string
-	IDList  []string
-	timer   *time.Timer
+	ID       int64
+	Name     string
+	Language string
+	// State is the conversation state the user is in, StateAt is when it was entered.
+	State   string
+	StateAt time.Time
+	// Draft is the wish being filled in by the multi-step add flow.
+	Draft  *entity.Wish
+	IDList []string
+	ListID string
+	Page   int
+	// Viewing and ViewingList describe someone else's wishlist the user is
+	// browsing. Unlocked holds the IDs of the lists of Viewing the user gave
+	// the password of, the password itself is not kept.
+	Viewing     int64
+	ViewingList string
+	Unlocked    []string
+	ViewingPage int
+	SharedList  string
+	// Banned is copied from the stored user when the session starts.
+	Banned bool
+	// Broadcast is the message an admin is about to send to every user.
+	Broadcast string
+}
+
+func New(store Store) *Manager {
+	return &Manager{store: store}
 }
 
-func New() *Manager {
-	return &Manager{
-		Users: make(map[int64]*User),
-		mu:    sync.Mutex{},
+func (m *Manager) AddUser(ctx context.Context, id int64, username string) (*User, error) {
+	user := &User{
+		ID:   id,
+		Name: username,
 	}
+	if err := m.store.Save(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-func (m *Manager) timer(id int64) *time.Timer {
-	return time.AfterFunc(t, func() {
-		m.mu.Lock()
-		defer m.mu.Unlock()
-		delete(m.Users, id)
-	})
+func (m *Manager) GetUser(ctx context.Context, id int64) (*User, error) {
+	return m.store.Get(ctx, id)
 }
 
-func (m *Manager) AddUser(id int64, username string) *User {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.Users[id] = &User{
-		ID:      id,
-		Name:    username,
-		Request: "",
-		Action:  "default",
-		IDList:  nil,
-		timer:   m.timer(id),
-	}
-	return m.Users[id]
+func (m *Manager) Save(ctx context.Context, user *User) error {
+	return m.store.Save(ctx, user)
 }
 
-func (m *Manager) GetUser(id int64) *User {
-	user, ok := m.Users[id]
-	if !ok {
-		return nil
-	}
-	user.updateTimer()
-	return user
+// Delete ends the session of the user, so it is loaded anew on the next request.
+func (m *Manager) Delete(ctx context.Context, id int64) error {
+	return m.store.Delete(ctx, id)
 }
 
-func (u *User) updateTimer() {
-	if !u.timer.Stop() {
-		<-u.timer.C
+func (m *Manager) Count(ctx context.Context) (int, error) {
+	return m.store.Count(ctx)
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.IDList = slices.Clone(u.IDList)
+	c.Unlocked = slices.Clone(u.Unlocked)
+	if u.Draft != nil {
+		draft := *u.Draft
+		c.Draft = &draft
 	}
-	u.timer.Reset(t)
+	return &c
+}
+
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying the session of the user the request belongs to.
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+func FromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(userKey{}).(*User)
+	return user
 }
@@ -0,0 +1,143 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/entity"
+)
+
+// stores runs test against every store, made with the given TTL.
+func stores(t *testing.T, test func(t *testing.T, newStore func(ttl time.Duration) Store)) {
+	t.Run("memory", func(t *testing.T) {
+		t.Parallel()
+		test(t, func(ttl time.Duration) Store {
+			s := NewMemory(ttl)
+			t.Cleanup(func() { s.Close() })
+			return s
+		})
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "sessions.sqlite")
+		test(t, func(ttl time.Duration) Store {
+			s, err := NewSQLite(context.Background(), path, ttl)
+			if err != nil {
+				t.Fatalf("NewSQLite: %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		})
+	})
+}
+
+func TestSaveGet(t *testing.T) {
+	stores(t, func(t *testing.T, newStore func(time.Duration) Store) {
+		ctx := context.Background()
+		s := newStore(time.Minute)
+		user := &User{
+			ID:       1,
+			Name:     "alice",
+			State:    "add",
+			StateAt:  time.Now().Truncate(time.Second),
+			Draft:    &entity.Wish{Content: "Tea"},
+			IDList:   []string{"a", "b"},
+			Unlocked: []string{"list"},
+			Viewing:  2,
+		}
+		if err := s.Save(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		// The stored session does not change along with the saved one.
+		user.IDList[0] = "changed"
+		user.Draft.Content = "changed"
+		got, err := s.Get(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.Name != "alice" || got.State != "add" || !got.StateAt.Equal(user.StateAt) ||
+			got.Draft.Content != "Tea" || got.IDList[0] != "a" || got.Unlocked[0] != "list" || got.Viewing != 2 {
+			t.Errorf("Get() = %+v", got)
+		}
+		if got, err = s.Get(ctx, 2); got != nil || err != nil {
+			t.Errorf("Get() of a missing session = %+v, %v, want nil", got, err)
+		}
+		if n, err := s.Count(ctx); n != 1 || err != nil {
+			t.Errorf("Count() = %d, %v, want 1", n, err)
+		}
+		if err = s.Delete(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+		if got, err = s.Get(ctx, 1); got != nil || err != nil {
+			t.Errorf("Get() after Delete = %+v, %v, want nil", got, err)
+		}
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	stores(t, func(t *testing.T, newStore func(time.Duration) Store) {
+		ctx := context.Background()
+		// SQLite keeps the expiry in whole seconds, so the TTL and the waits
+		// are long enough for the rounding not to matter.
+		s := newStore(3 * time.Second)
+		for _, id := range []int64{1, 2} {
+			if err := s.Save(ctx, &User{ID: id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Reading a session extends its lifetime.
+		time.Sleep(1500 * time.Millisecond)
+		if got, err := s.Get(ctx, 1); got == nil || err != nil {
+			t.Fatalf("Get() = %v, %v, want the session", got, err)
+		}
+		time.Sleep(2 * time.Second)
+		if got, err := s.Get(ctx, 2); got != nil || err != nil {
+			t.Errorf("Get() of an expired session = %+v, %v, want nil", got, err)
+		}
+		if n, err := s.Count(ctx); n != 1 || err != nil {
+			t.Errorf("Count() = %d, %v, want 1", n, err)
+		}
+	})
+}
+
+func TestSQLitePersists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "sessions.sqlite")
+	s, err := NewSQLite(ctx, path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Save(ctx, &User{ID: 1, ListID: "list", Page: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+	s, err = NewSQLite(ctx, path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got, err := s.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ListID != "list" || got.Page != 3 {
+		t.Errorf("Get() after reopening = %+v", got)
+	}
+}
+
+func TestMemoryClose(t *testing.T) {
+	m := NewMemory(time.Minute)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type SQLite struct {
+	db   *sql.DB
+	ttl  time.Duration
+	done chan struct{}
+	once sync.Once
+}
+
+func NewSQLite(ctx context.Context, file string, ttl time.Duration) (*SQLite, error) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if err := os.MkdirAll(path.Dir(file), 0750); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		return nil, err
+	}
+	query := `CREATE TABLE IF NOT EXISTS sessions(
+				user_id INT PRIMARY KEY NOT NULL,
+				data TEXT NOT NULL,
+				expires_at INT NOT NULL
+			 )`
+	if _, err = db.ExecContext(ctx, query); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &SQLite{db: db, ttl: ttl, done: make(chan struct{})}
+	go s.cleanup()
+	return s, nil
+}
+
+func (s *SQLite) cleanup() {
+	ticker := time.NewTicker(s.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			_, _ = s.db.Exec(`DELETE FROM sessions WHERE expires_at <= ?`, now.Unix())
+		}
+	}
+}
+
+func (s *SQLite) Get(ctx context.Context, id int64) (*User, error) {
+	query := `SELECT data FROM sessions WHERE user_id = ? AND expires_at > ?`
+	var data []byte
+	err := s.db.QueryRowContext(ctx, query, id, time.Now().Unix()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	user := &User{}
+	if err = json.Unmarshal(data, user); err != nil {
+		return nil, err
+	}
+	query = `UPDATE sessions SET expires_at = ? WHERE user_id = ?`
+	if _, err = s.db.ExecContext(ctx, query, time.Now().Add(s.ttl).Unix(), id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *SQLite) Save(ctx context.Context, user *User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO sessions(user_id, data, expires_at) VALUES (?, ?, ?)
+			  ON CONFLICT (user_id) DO UPDATE SET data = excluded.data, expires_at = excluded.expires_at`
+	_, err = s.db.ExecContext(ctx, query, user.ID, data, time.Now().Add(s.ttl).Unix())
+	return err
+}
+
+func (s *SQLite) Delete(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, id)
+	return err
+}
+
+func (s *SQLite) Count(ctx context.Context) (int, error) {
+	query := `SELECT COUNT(*) FROM sessions WHERE expires_at > ?`
+	var n int
+	err := s.db.QueryRowContext(ctx, query, time.Now().Unix()).Scan(&n)
+	return n, err
+}
+
+func (s *SQLite) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		err = s.db.Close()
+	})
+	return err
+}
@@ -0,0 +1,26 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/eugene-static/wishlist_bot/app/lib/config"
+)
+
+const (
+	DriverMemory = "memory"
+	DriverSQLite = "sqlite3"
+)
+
+func NewStore(ctx context.Context, cfg *config.Session) (Store, error) {
+	ttl := time.Duration(cfg.TTL) * time.Second
+	switch cfg.Driver {
+	case "", DriverMemory:
+		return NewMemory(ttl), nil
+	case DriverSQLite:
+		return NewSQLite(ctx, cfg.Path, ttl)
+	default:
+		return nil, fmt.Errorf("unsupported session driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sync"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/entity"
+)
+
+type Memory struct {
+	mu           sync.RWMutex
+	users        map[int64]*entity.User
+	lists        []*entity.Wishlist
+	wishes       []*entity.Wish
+	reservations map[string]int64
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:        make(map[int64]*entity.User),
+		reservations: make(map[string]int64),
+	}
+}
+
+func (s *Memory) Close() error {
+	return nil
+}
+
+func (s *Memory) Ping(context.Context) error {
+	return nil
+}
+
+func (s *Memory) GetUserByID(_ context.Context, id int64) (*entity.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyUser(user), nil
+}
+
+func (s *Memory) GetUserByUsername(_ context.Context, username string) (*entity.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, user := range s.users {
+		if user.Name == username {
+			return copyUser(user), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Memory) AddUser(_ context.Context, user *entity.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.ID] = copyUser(user)
+	return nil
+}
+
+func (s *Memory) UpdateUserPassword(_ context.Context, id int64, new []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[id]; ok {
+		user.Password = append([]byte(nil), new...)
+	}
+	return nil
+}
+
+func (s *Memory) UpdateUsername(_ context.Context, id int64, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[id]; ok {
+		user.Name = username
+	}
+	return nil
+}
+
+func (s *Memory) UpdateUserLanguage(_ context.Context, id int64, language string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[id]; ok {
+		user.Language = language
+	}
+	return nil
+}
+
+func (s *Memory) UpdateUserBanned(_ context.Context, id int64, banned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[id]; ok {
+		user.Banned = banned
+	}
+	return nil
+}
+
+func (s *Memory) GetUserIDs(context.Context) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []int64
+	for id, user := range s.users {
+		if !user.Banned {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *Memory) Stats(context.Context) (*entity.Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := &entity.Stats{Users: len(s.users), Wishlists: len(s.lists), Wishes: len(s.wishes)}
+	for _, user := range s.users {
+		if user.Banned {
+			stats.Banned++
+		}
+	}
+	return stats, nil
+}
+
+func (s *Memory) CreateWishlist(_ context.Context, list *entity.Wishlist) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lists = append(s.lists, copyWishlist(list))
+	return nil
+}
+
+func (s *Memory) GetWishlist(_ context.Context, id string) (*entity.Wishlist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, list := range s.lists {
+		if list.ID == id {
+			return copyWishlist(list), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Memory) GetWishlistByToken(_ context.Context, token string) (*entity.Wishlist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, list := range s.lists {
+		if token != "" && list.ShareToken == token {
+			return copyWishlist(list), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Memory) GetWishlists(_ context.Context, userID int64) ([]*entity.Wishlist, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var lists []*entity.Wishlist
+	for _, list := range s.lists {
+		if list.UserID == userID {
+			lists = append(lists, copyWishlist(list))
+		}
+	}
+	return lists, nil
+}
+
+func (s *Memory) UpdateWishlist(_ context.Context, list *entity.Wishlist) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, l := range s.lists {
+		if l.ID == list.ID && l.UserID == list.UserID {
+			s.lists[i] = copyWishlist(list)
+		}
+	}
+	return nil
+}
+
+func (s *Memory) DeleteWishlist(_ context.Context, userID int64, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.lists, func(l *entity.Wishlist) bool { return l.ID == id && l.UserID == userID })
+	if i < 0 {
+		return false, nil
+	}
+	s.lists = slices.Delete(s.lists, i, i+1)
+	s.wishes = slices.DeleteFunc(s.wishes, func(w *entity.Wish) bool {
+		if w.ListID == id {
+			delete(s.reservations, w.ID)
+			return true
+		}
+		return false
+	})
+	return true, nil
+}
+
+func (s *Memory) CreateWish(_ context.Context, wish *entity.Wish) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.wishes {
+		if w.ID == wish.ID {
+			return nil
+		}
+	}
+	w := *wish
+	s.wishes = append(s.wishes, &w)
+	return nil
+}
+
+func (s *Memory) GetWishes(_ context.Context, listID string) ([]*entity.Wish, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*entity.Wish
+	for _, w := range s.wishes {
+		if w.ListID == listID {
+			wish := *w
+			wish.ReservedBy = s.reservations[w.ID]
+			list = append(list, &wish)
+		}
+	}
+	return list, nil
+}
+
+func (s *Memory) DeleteWishes(_ context.Context, userID int64, ids []string) (int64, error) {
+	remove := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		remove[id] = struct{}{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	wishes := s.wishes[:0]
+	for _, w := range s.wishes {
+		if _, ok := remove[w.ID]; ok && w.UserID == userID {
+			delete(s.reservations, w.ID)
+			deleted++
+			continue
+		}
+		wishes = append(wishes, w)
+	}
+	clear(s.wishes[len(wishes):])
+	s.wishes = wishes
+	return deleted, nil
+}
+
+func (s *Memory) ReserveWish(_ context.Context, wishID string, userID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reservations[wishID]; ok {
+		return false, nil
+	}
+	for _, w := range s.wishes {
+		if w.ID == wishID {
+			s.reservations[wishID] = userID
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Memory) UnreserveWish(_ context.Context, wishID string, userID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reserver, ok := s.reservations[wishID]; !ok || reserver != userID {
+		return false, nil
+	}
+	delete(s.reservations, wishID)
+	return true, nil
+}
+
+func copyWishlist(list *entity.Wishlist) *entity.Wishlist {
+	l := *list
+	l.Password = append([]byte(nil), list.Password...)
+	return &l
+}
+
+func copyUser(user *entity.User) *entity.User {
+	u := *user
+	u.Password = append([]byte(nil), user.Password...)
+	return &u
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrations embed.FS
+
+var ErrSchemaTooNew = errors.New("database schema is newer than the application supports")
+
+type Migration struct {
+	Version int
+	Name    string
+	query   string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, driver string) (*Migrator, error) {
+	var dir string
+	switch driver {
+	case DriverSQLite:
+		dir = "migrations/sqlite"
+	case DriverPostgres:
+		dir = "migrations/postgres"
+	default:
+		return nil, fmt.Errorf("no migrations for storage driver %q", driver)
+	}
+	list, err := loadMigrations(migrations, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, driver: driver, migrations: list}, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var list []Migration
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || path.Ext(name) != ".sql" {
+			continue
+		}
+		num, title, _ := strings.Cut(strings.TrimSuffix(name, ".sql"), "_")
+		version, err := strconv.Atoi(num)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		query, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, Migration{Version: version, Name: title, query: string(query)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i := 1; i < len(list); i++ {
+		if list[i].Version == list[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", list[i].Version)
+		}
+	}
+	return list, nil
+}
+
+func (m *Migrator) init(ctx context.Context) error {
+	query := `CREATE TABLE IF NOT EXISTS schema_version(
+				version INT PRIMARY KEY NOT NULL,
+				name TEXT,
+				applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			 )`
+	_, err := m.db.ExecContext(ctx, query)
+	return err
+}
+
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) Current(ctx context.Context) (int, error) {
+	if err := m.init(ctx); err != nil {
+		return 0, err
+	}
+	query := `SELECT COALESCE(MAX(version), 0) FROM schema_version`
+	var version int
+	err := m.db.QueryRowContext(ctx, query).Scan(&version)
+	return version, err
+}
+
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current > m.Latest() {
+		return nil, fmt.Errorf("%w: version %d, latest known %d", ErrSchemaTooNew, current, m.Latest())
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if migration.Version > current {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// migrationLock is the key of the Postgres advisory lock held while migrating.
+const migrationLock = 0x77697368
+
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	// Replicas starting together against one database wait for each other
+	// instead of applying the same migrations twice.
+	if m.driver == DriverPostgres {
+		conn, err := m.db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+			return nil, fmt.Errorf("locking migrations: %w", err)
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLock)
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, migration := range pending {
+		if err = m.apply(ctx, migration); err != nil {
+			return pending[:i], fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, migration.query); err != nil {
+		return err
+	}
+	query := `INSERT INTO schema_version(version, name) VALUES (?, ?)`
+	if m.driver == DriverPostgres {
+		query = `INSERT INTO schema_version(version, name) VALUES ($1, $2)`
+	}
+	if _, err = tx.ExecContext(ctx, query, migration.Version, migration.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
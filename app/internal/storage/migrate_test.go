@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/eugene-static/wishlist_bot/app/lib/config"
+)
+
+func openSQLite(t *testing.T) (*sql.DB, *config.Storage) {
+	t.Helper()
+	cfg := &config.Storage{Driver: DriverSQLite, Path: filepath.Join(t.TempDir(), "wishlist.sqlite")}
+	db, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, cfg
+}
+
+// testMigrator runs the migrations in files instead of the embedded ones.
+func testMigrator(t *testing.T, db *sql.DB, files fstest.MapFS) *Migrator {
+	t.Helper()
+	list, err := loadMigrations(files, ".")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	return &Migrator{db: db, driver: DriverSQLite, migrations: list}
+}
+
+func versions(migrations []Migration) []int {
+	var v []int
+	for _, migration := range migrations {
+		v = append(v, migration.Version)
+	}
+	return v
+}
+
+func TestMigratorUp(t *testing.T) {
+	ctx := context.Background()
+	db, _ := openSQLite(t)
+	m, err := NewMigrator(db, DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != len(m.migrations) {
+		t.Errorf("applied %v, want all %d migrations", versions(applied), len(m.migrations))
+	}
+	var rows, latest int
+	if err = db.QueryRow(`SELECT COUNT(*), MAX(version) FROM schema_version`).Scan(&rows, &latest); err != nil {
+		t.Fatal(err)
+	}
+	if rows != len(m.migrations) || latest != m.Latest() {
+		t.Errorf("schema_version has %d rows up to %d, want %d up to %d", rows, latest, len(m.migrations), m.Latest())
+	}
+	if applied, err = m.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("second Up applied %v, %v, want nothing", versions(applied), err)
+	}
+}
+
+// TestMigratorDefaultListName checks that the lists made for existing users
+// get no name, so that it is shown in the language of the reader.
+func TestMigratorDefaultListName(t *testing.T) {
+	ctx := context.Background()
+	db, _ := openSQLite(t)
+	m, err := NewMigrator(db, DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := m.migrations
+	m.migrations = all[:3]
+	if _, err = m.Up(ctx); err != nil {
+		t.Fatalf("Up to 3: %v", err)
+	}
+	if _, err = db.Exec(`INSERT INTO users(id, username) VALUES (1, 'alice')`); err != nil {
+		t.Fatal(err)
+	}
+	m.migrations = all
+	if _, err = m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	var name string
+	if err = db.QueryRow(`SELECT name FROM wishlists WHERE user_id = 1`).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "" {
+		t.Errorf("migrated list is named %q, want no name", name)
+	}
+}
+
+func TestMigratorRollsBackFailedMigration(t *testing.T) {
+	ctx := context.Background()
+	db, _ := openSQLite(t)
+	m := testMigrator(t, db, fstest.MapFS{
+		"0001_first.sql":  {Data: []byte(`CREATE TABLE first(id INT);`)},
+		"0002_broken.sql": {Data: []byte(`CREATE TABLE second(id INT); INSERT INTO missing VALUES (1);`)},
+		"0003_third.sql":  {Data: []byte(`CREATE TABLE third(id INT);`)},
+	})
+	applied, err := m.Up(ctx)
+	if err == nil {
+		t.Fatal("Up succeeded with a broken migration")
+	}
+	if got := versions(applied); len(got) != 1 || got[0] != 1 {
+		t.Errorf("applied %v, want [1]", got)
+	}
+	if current, err := m.Current(ctx); err != nil || current != 1 {
+		t.Errorf("Current = %d, %v, want 1", current, err)
+	}
+	for table, want := range map[string]int{"first": 1, "second": 0, "third": 0} {
+		var n int
+		if err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("table %s exists %d times, want %d", table, n, want)
+		}
+	}
+}
+
+func TestMigratorRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	db, cfg := openSQLite(t)
+	m, err := NewMigrator(db, DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if _, err = db.Exec(`INSERT INTO schema_version(version, name) VALUES (?, 'future')`, m.Latest()+1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.Pending(ctx); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Pending error = %v, want %v", err, ErrSchemaTooNew)
+	}
+	if _, err = m.Up(ctx); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Up error = %v, want %v", err, ErrSchemaTooNew)
+	}
+	if _, err = New(ctx, cfg); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("New error = %v, want %v", err, ErrSchemaTooNew)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  []int
+		fail  bool
+	}{
+		{
+			name: "sorted",
+			files: fstest.MapFS{
+				"0010_ten.sql": {},
+				"0002_two.sql": {},
+				"README.md":    {},
+			},
+			want: []int{2, 10},
+		},
+		{
+			name:  "no version",
+			files: fstest.MapFS{"init.sql": {}},
+			fail:  true,
+		},
+		{
+			name:  "duplicate version",
+			files: fstest.MapFS{"0001_a.sql": {}, "1_b.sql": {}},
+			fail:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := loadMigrations(tt.files, ".")
+			if (err != nil) != tt.fail {
+				t.Fatalf("loadMigrations error = %v, want failure %v", err, tt.fail)
+			}
+			if got := versions(list); !slices.Equal(got, tt.want) {
+				t.Errorf("versions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
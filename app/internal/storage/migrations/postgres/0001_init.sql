@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS users(
+    id BIGINT PRIMARY KEY NOT NULL,
+    username TEXT,
+    password BYTEA
+);
+CREATE TABLE IF NOT EXISTS wishes(
+    id VARCHAR(16) PRIMARY KEY,
+    seq BIGSERIAL,
+    content TEXT,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS reservations(
+    wish_id VARCHAR(16) PRIMARY KEY REFERENCES wishes(id) ON DELETE CASCADE,
+    reserver_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
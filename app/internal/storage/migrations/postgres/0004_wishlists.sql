@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS wishlists(
+    id VARCHAR(16) PRIMARY KEY,
+    seq BIGSERIAL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    password BYTEA,
+    hidden BOOLEAN NOT NULL DEFAULT FALSE
+);
+INSERT INTO wishlists(id, user_id, name, password)
+SELECT substr(md5(random()::text || id::text), 1, 16), id, '', password FROM users;
+ALTER TABLE wishes ADD COLUMN IF NOT EXISTS list_id VARCHAR(16) REFERENCES wishlists(id) ON DELETE CASCADE;
+UPDATE wishes SET list_id = (SELECT wishlists.id FROM wishlists WHERE wishlists.user_id = wishes.user_id);
+CREATE INDEX IF NOT EXISTS wishes_list_id ON wishes(list_id);
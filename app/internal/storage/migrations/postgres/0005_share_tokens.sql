@@ -0,0 +1,2 @@
+ALTER TABLE wishlists ADD COLUMN IF NOT EXISTS share_token VARCHAR(32);
+CREATE UNIQUE INDEX IF NOT EXISTS wishlists_share_token ON wishlists(share_token);
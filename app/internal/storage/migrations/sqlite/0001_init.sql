@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS users(
+    id INT PRIMARY KEY UNIQUE NOT NULL,
+    username TEXT,
+    password BLOB
+);
+CREATE TABLE IF NOT EXISTS wishes(
+    id VARCHAR(16) PRIMARY KEY UNIQUE,
+    content TEXT,
+    user_id INT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+ALTER TABLE wishes ADD COLUMN link TEXT NOT NULL DEFAULT '';
+ALTER TABLE wishes ADD COLUMN price INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE wishes ADD COLUMN currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE wishes ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE wishes ADD COLUMN quantity INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE wishes ADD COLUMN note TEXT NOT NULL DEFAULT '';
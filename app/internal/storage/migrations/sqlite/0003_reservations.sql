@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS reservations(
+    wish_id VARCHAR(16) PRIMARY KEY NOT NULL,
+    reserver_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (wish_id) REFERENCES wishes(id) ON DELETE CASCADE,
+    FOREIGN KEY (reserver_id) REFERENCES users(id) ON DELETE CASCADE
+);
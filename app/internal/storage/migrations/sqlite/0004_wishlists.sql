@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS wishlists(
+    id VARCHAR(16) PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL,
+    name TEXT NOT NULL,
+    password BLOB,
+    hidden INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO wishlists(id, user_id, name, password)
+SELECT lower(hex(randomblob(8))), id, '', password FROM users;
+ALTER TABLE wishes ADD COLUMN list_id VARCHAR(16) REFERENCES wishlists(id) ON DELETE CASCADE;
+UPDATE wishes SET list_id = (SELECT wishlists.id FROM wishlists WHERE wishlists.user_id = wishes.user_id);
+CREATE INDEX IF NOT EXISTS wishes_list_id ON wishes(list_id);
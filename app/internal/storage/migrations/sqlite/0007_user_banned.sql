@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN banned INTEGER NOT NULL DEFAULT 0;
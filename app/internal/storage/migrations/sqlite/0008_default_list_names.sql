@@ -0,0 +1,3 @@
+-- Lists migrated by 0004 were named in Russian, an empty name shows the
+-- default name in the language of the reader.
+UPDATE wishlists SET name = '' WHERE name = 'Мой вишлист';
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/entity"
+	"github.com/lib/pq"
+)
+
+const uniqueViolation = "23505"
+
+type Postgres struct {
+	db *sql.DB
+}
+
+func (s *Postgres) Close() error {
+	return s.db.Close()
+}
+
+func (s *Postgres) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Postgres) GetUserByID(ctx context.Context, id int64) (*entity.User, error) {
+	query := `SELECT username, password, language, banned FROM users WHERE id = $1`
+	user := &entity.User{ID: id}
+	if err := s.db.QueryRowContext(ctx, query, id).Scan(&user.Name, &user.Password, &user.Language, &user.Banned); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *Postgres) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	query := `SELECT id, password, language, banned FROM users WHERE username = $1`
+	user := &entity.User{Name: username}
+	if err := s.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Password, &user.Language, &user.Banned); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *Postgres) AddUser(ctx context.Context, user *entity.User) error {
+	query := `INSERT INTO users(id, username, password, language) VALUES ($1, $2, $3, $4)`
+	_, err := s.db.ExecContext(ctx, query, user.ID, user.Name, user.Password, user.Language)
+	return err
+}
+
+func (s *Postgres) UpdateUserPassword(ctx context.Context, id int64, new []byte) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+	_, err := s.db.ExecContext(ctx, query, new, id)
+	return err
+}
+
+func (s *Postgres) UpdateUsername(ctx context.Context, id int64, username string) error {
+	query := `UPDATE users SET username = $1 WHERE id = $2`
+	_, err := s.db.ExecContext(ctx, query, username, id)
+	return err
+}
+
+func (s *Postgres) UpdateUserLanguage(ctx context.Context, id int64, language string) error {
+	query := `UPDATE users SET language = $1 WHERE id = $2`
+	_, err := s.db.ExecContext(ctx, query, language, id)
+	return err
+}
+
+func (s *Postgres) UpdateUserBanned(ctx context.Context, id int64, banned bool) error {
+	query := `UPDATE users SET banned = $1 WHERE id = $2`
+	_, err := s.db.ExecContext(ctx, query, banned, id)
+	return err
+}
+
+func (s *Postgres) GetUserIDs(ctx context.Context) ([]int64, error) {
+	query := `SELECT id FROM users WHERE NOT banned ORDER BY id`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *Postgres) Stats(ctx context.Context) (*entity.Stats, error) {
+	query := `SELECT (SELECT COUNT(*) FROM users),
+			  (SELECT COUNT(*) FROM users WHERE banned),
+			  (SELECT COUNT(*) FROM wishlists),
+			  (SELECT COUNT(*) FROM wishes)`
+	stats := &entity.Stats{}
+	if err := s.db.QueryRowContext(ctx, query).Scan(&stats.Users, &stats.Banned, &stats.Wishlists,
+		&stats.Wishes); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (s *Postgres) CreateWishlist(ctx context.Context, list *entity.Wishlist) error {
+	query := `INSERT INTO wishlists(id, user_id, name, password, hidden, share_token)
+			  VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))`
+	_, err := s.db.ExecContext(ctx, query, list.ID, list.UserID, list.Name, list.Password, list.Hidden, list.ShareToken)
+	return err
+}
+
+func (s *Postgres) GetWishlist(ctx context.Context, id string) (*entity.Wishlist, error) {
+	query := `SELECT user_id, name, password, hidden, COALESCE(share_token, '') FROM wishlists WHERE id = $1`
+	list := &entity.Wishlist{ID: id}
+	if err := s.db.QueryRowContext(ctx, query, id).Scan(&list.UserID, &list.Name, &list.Password, &list.Hidden,
+		&list.ShareToken); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *Postgres) GetWishlistByToken(ctx context.Context, token string) (*entity.Wishlist, error) {
+	query := `SELECT id, user_id, name, password, hidden FROM wishlists WHERE share_token = $1`
+	list := &entity.Wishlist{ShareToken: token}
+	if err := s.db.QueryRowContext(ctx, query, token).Scan(&list.ID, &list.UserID, &list.Name, &list.Password,
+		&list.Hidden); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *Postgres) GetWishlists(ctx context.Context, userID int64) ([]*entity.Wishlist, error) {
+	query := `SELECT id, name, password, hidden, COALESCE(share_token, '') FROM wishlists WHERE user_id = $1 ORDER BY seq`
+	var lists []*entity.Wishlist
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		list := &entity.Wishlist{UserID: userID}
+		if err = rows.Scan(&list.ID, &list.Name, &list.Password, &list.Hidden, &list.ShareToken); err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+func (s *Postgres) UpdateWishlist(ctx context.Context, list *entity.Wishlist) error {
+	query := `UPDATE wishlists SET name = $1, password = $2, hidden = $3, share_token = NULLIF($4, '')
+			  WHERE id = $5 AND user_id = $6`
+	_, err := s.db.ExecContext(ctx, query, list.Name, list.Password, list.Hidden, list.ShareToken, list.ID, list.UserID)
+	return err
+}
+
+func (s *Postgres) DeleteWishlist(ctx context.Context, userID int64, id string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `DELETE FROM wishlists WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM wishes WHERE list_id = $1`, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *Postgres) CreateWish(ctx context.Context, wish *entity.Wish) error {
+	query := `INSERT INTO wishes(id, content, link, price, currency, priority, quantity, note, list_id, user_id)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := s.db.ExecContext(ctx, query, wish.ID, wish.Content, wish.Link, wish.Price, wish.Currency,
+		wish.Priority, wish.Quantity, wish.Note, wish.ListID, wish.UserID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return nil
+	}
+	return err
+}
+
+func (s *Postgres) GetWishes(ctx context.Context, listID string) ([]*entity.Wish, error) {
+	query := `SELECT w.id, w.content, w.link, w.price, w.currency, w.priority, w.quantity, w.note, w.user_id,
+			  COALESCE(r.reserver_id, 0) FROM wishes w LEFT JOIN reservations r ON r.wish_id = w.id
+			  WHERE w.list_id = $1 ORDER BY w.seq`
+	var list []*entity.Wish
+	rows, err := s.db.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		wish := &entity.Wish{ListID: listID}
+		if err = rows.Scan(&wish.ID, &wish.Content, &wish.Link, &wish.Price, &wish.Currency,
+			&wish.Priority, &wish.Quantity, &wish.Note, &wish.UserID, &wish.ReservedBy); err != nil {
+			return nil, err
+		}
+		list = append(list, wish)
+	}
+	return list, rows.Err()
+}
+
+func (s *Postgres) DeleteWishes(ctx context.Context, userID int64, ids []string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM wishes WHERE id = $1 AND user_id = $2`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	var deleted int64
+	for _, id := range ids {
+		res, err := stmt.ExecContext(ctx, id, userID)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+	return deleted, tx.Commit()
+}
+
+func (s *Postgres) ReserveWish(ctx context.Context, wishID string, userID int64) (bool, error) {
+	query := `INSERT INTO reservations(wish_id, reserver_id) VALUES ($1, $2) ON CONFLICT (wish_id) DO NOTHING`
+	res, err := s.db.ExecContext(ctx, query, wishID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Postgres) UnreserveWish(ctx context.Context, wishID string, userID int64) (bool, error) {
+	query := `DELETE FROM reservations WHERE wish_id = $1 AND reserver_id = $2`
+	res, err := s.db.ExecContext(ctx, query, wishID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
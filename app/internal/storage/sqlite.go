@@ -4,102 +4,201 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"os"
-	"path"
 
 	"github.com/eugene-static/wishlist_bot/app/internal/entity"
-	"github.com/eugene-static/wishlist_bot/app/lib/config"
 	"github.com/mattn/go-sqlite3"
 )
 
-type Storage struct {
+type SQLite struct {
 	db *sql.DB
 }
 
-func New(ctx context.Context, cfg *config.Storage) (*Storage, error) {
-	err := os.MkdirAll(path.Dir(cfg.Path), 0750)
-	if err != nil {
-		return nil, err
-	}
-	db, err := sql.Open(cfg.Driver, cfg.Path)
-	if err != nil {
-		return nil, err
-	}
-	query := `CREATE TABLE IF NOT EXISTS users(
-    			id INT PRIMARY KEY UNIQUE NOT NULL,
-    			username TEXT,
-    			password BLOB
-			 );	
-			  CREATE TABLE IF NOT EXISTS wishes(
-				id VARCHAR(16) PRIMARY KEY UNIQUE,
-				content TEXT,
-				user_id INT,
-			    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-			 )`
-	if _, err = db.ExecContext(ctx, query); err != nil {
-		return nil, err
-	}
-	return &Storage{db: db}, nil
+func (s *SQLite) Close() error {
+	return s.db.Close()
 }
 
-func (s *Storage) Close() error {
-	return s.db.Close()
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
 }
-func (s *Storage) GetUserByID(ctx context.Context, id int64) (*entity.User, error) {
-	query := `SELECT username, password FROM users WHERE id = ?`
+
+func (s *SQLite) GetUserByID(ctx context.Context, id int64) (*entity.User, error) {
+	query := `SELECT username, password, language, banned FROM users WHERE id = ?`
 	user := &entity.User{ID: id}
-	if err := s.db.QueryRowContext(ctx, query, id).Scan(&user.Name, &user.Password); err != nil {
+	if err := s.db.QueryRowContext(ctx, query, id).Scan(&user.Name, &user.Password, &user.Language, &user.Banned); err != nil {
 		return nil, err
 	}
 	return user, nil
 }
-func (s *Storage) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
-	query := `SELECT id, password FROM users WHERE username = ?`
+
+func (s *SQLite) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	query := `SELECT id, password, language, banned FROM users WHERE username = ?`
 	user := &entity.User{Name: username}
-	if err := s.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Password); err != nil {
+	if err := s.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Password, &user.Language, &user.Banned); err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (s *Storage) AddUser(ctx context.Context, user *entity.User) error {
-	query := `INSERT INTO users(id, username, password) VALUES (?, ?, ?)`
-	_, err := s.db.ExecContext(ctx, query, user.ID, user.Name, user.Password)
+func (s *SQLite) AddUser(ctx context.Context, user *entity.User) error {
+	query := `INSERT INTO users(id, username, password, language) VALUES (?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, user.ID, user.Name, user.Password, user.Language)
 	return err
 }
 
-func (s *Storage) UpdateUserPassword(ctx context.Context, id int64, new []byte) error {
+func (s *SQLite) UpdateUserPassword(ctx context.Context, id int64, new []byte) error {
 	query := `UPDATE users SET password = ? WHERE id = ?`
 	_, err := s.db.ExecContext(ctx, query, new, id)
 	return err
 }
 
-func (s *Storage) UpdateUsername(ctx context.Context, id int64, username string) error {
+func (s *SQLite) UpdateUsername(ctx context.Context, id int64, username string) error {
 	query := `UPDATE users SET username = ? WHERE id = ?`
 	_, err := s.db.ExecContext(ctx, query, username, id)
 	return err
 }
 
-func (s *Storage) CreateWish(ctx context.Context, wish *entity.Wish) error {
-	query := `INSERT INTO wishes(id, content, user_id) VALUES (?, ?, ?)`
-	_, err := s.db.ExecContext(ctx, query, wish.ID, wish.Content, wish.UserID)
-	if errors.Is(err, sqlite3.ErrConstraintUnique) {
+func (s *SQLite) UpdateUserLanguage(ctx context.Context, id int64, language string) error {
+	query := `UPDATE users SET language = ? WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, query, language, id)
+	return err
+}
+
+func (s *SQLite) UpdateUserBanned(ctx context.Context, id int64, banned bool) error {
+	query := `UPDATE users SET banned = ? WHERE id = ?`
+	_, err := s.db.ExecContext(ctx, query, banned, id)
+	return err
+}
+
+func (s *SQLite) GetUserIDs(ctx context.Context) ([]int64, error) {
+	query := `SELECT id FROM users WHERE NOT banned ORDER BY id`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *SQLite) Stats(ctx context.Context) (*entity.Stats, error) {
+	query := `SELECT (SELECT COUNT(*) FROM users),
+			  (SELECT COUNT(*) FROM users WHERE banned),
+			  (SELECT COUNT(*) FROM wishlists),
+			  (SELECT COUNT(*) FROM wishes)`
+	stats := &entity.Stats{}
+	if err := s.db.QueryRowContext(ctx, query).Scan(&stats.Users, &stats.Banned, &stats.Wishlists,
+		&stats.Wishes); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (s *SQLite) CreateWishlist(ctx context.Context, list *entity.Wishlist) error {
+	query := `INSERT INTO wishlists(id, user_id, name, password, hidden, share_token)
+			  VALUES (?, ?, ?, ?, ?, NULLIF(?, ''))`
+	_, err := s.db.ExecContext(ctx, query, list.ID, list.UserID, list.Name, list.Password, list.Hidden, list.ShareToken)
+	return err
+}
+
+func (s *SQLite) GetWishlist(ctx context.Context, id string) (*entity.Wishlist, error) {
+	query := `SELECT user_id, name, password, hidden, COALESCE(share_token, '') FROM wishlists WHERE id = ?`
+	list := &entity.Wishlist{ID: id}
+	if err := s.db.QueryRowContext(ctx, query, id).Scan(&list.UserID, &list.Name, &list.Password, &list.Hidden,
+		&list.ShareToken); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *SQLite) GetWishlistByToken(ctx context.Context, token string) (*entity.Wishlist, error) {
+	query := `SELECT id, user_id, name, password, hidden FROM wishlists WHERE share_token = ?`
+	list := &entity.Wishlist{ShareToken: token}
+	if err := s.db.QueryRowContext(ctx, query, token).Scan(&list.ID, &list.UserID, &list.Name, &list.Password,
+		&list.Hidden); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *SQLite) GetWishlists(ctx context.Context, userID int64) ([]*entity.Wishlist, error) {
+	query := `SELECT id, name, password, hidden, COALESCE(share_token, '') FROM wishlists WHERE user_id = ? ORDER BY rowid`
+	var lists []*entity.Wishlist
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		list := &entity.Wishlist{UserID: userID}
+		if err = rows.Scan(&list.ID, &list.Name, &list.Password, &list.Hidden, &list.ShareToken); err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+func (s *SQLite) UpdateWishlist(ctx context.Context, list *entity.Wishlist) error {
+	query := `UPDATE wishlists SET name = ?, password = ?, hidden = ?, share_token = NULLIF(?, '')
+			  WHERE id = ? AND user_id = ?`
+	_, err := s.db.ExecContext(ctx, query, list.Name, list.Password, list.Hidden, list.ShareToken, list.ID, list.UserID)
+	return err
+}
+
+func (s *SQLite) DeleteWishlist(ctx context.Context, userID int64, id string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `DELETE FROM wishlists WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM wishes WHERE list_id = ?`, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *SQLite) CreateWish(ctx context.Context, wish *entity.Wish) error {
+	query := `INSERT INTO wishes(id, content, link, price, currency, priority, quantity, note, list_id, user_id)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, query, wish.ID, wish.Content, wish.Link, wish.Price, wish.Currency,
+		wish.Priority, wish.Quantity, wish.Note, wish.ListID, wish.UserID)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique) {
 		return nil
 	}
 	return err
 }
 
-func (s *Storage) GetWishes(ctx context.Context, id int64) ([]*entity.Wish, error) {
-	query := `SELECT id, content FROM wishes WHERE user_id = ?`
+func (s *SQLite) GetWishes(ctx context.Context, listID string) ([]*entity.Wish, error) {
+	query := `SELECT w.id, w.content, w.link, w.price, w.currency, w.priority, w.quantity, w.note, w.user_id,
+			  COALESCE(r.reserver_id, 0) FROM wishes w LEFT JOIN reservations r ON r.wish_id = w.id
+			  WHERE w.list_id = ? ORDER BY w.rowid`
 	var list []*entity.Wish
-	rows, err := s.db.QueryContext(ctx, query, id)
+	rows, err := s.db.QueryContext(ctx, query, listID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
-		wish := &entity.Wish{}
-		if err = rows.Scan(&wish.ID, &wish.Content); err != nil {
+		wish := &entity.Wish{ListID: listID}
+		if err = rows.Scan(&wish.ID, &wish.Content, &wish.Link, &wish.Price, &wish.Currency,
+			&wish.Priority, &wish.Quantity, &wish.Note, &wish.UserID, &wish.ReservedBy); err != nil {
 			return nil, err
 		}
 		list = append(list, wish)
@@ -107,8 +206,48 @@ func (s *Storage) GetWishes(ctx context.Context, id int64) ([]*entity.Wish, erro
 	return list, rows.Err()
 }
 
-func (s *Storage) DeleteWishes(ctx context.Context, ids string) error {
-	query := fmt.Sprintf(`DELETE FROM wishes WHERE id IN (%s)`, ids)
-	_, err := s.db.ExecContext(ctx, query)
-	return err
+func (s *SQLite) DeleteWishes(ctx context.Context, userID int64, ids []string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM wishes WHERE id = ? AND user_id = ?`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	var deleted int64
+	for _, id := range ids {
+		res, err := stmt.ExecContext(ctx, id, userID)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+	return deleted, tx.Commit()
+}
+
+func (s *SQLite) ReserveWish(ctx context.Context, wishID string, userID int64) (bool, error) {
+	query := `INSERT INTO reservations(wish_id, reserver_id) VALUES (?, ?) ON CONFLICT (wish_id) DO NOTHING`
+	res, err := s.db.ExecContext(ctx, query, wishID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLite) UnreserveWish(ctx context.Context, wishID string, userID int64) (bool, error) {
+	query := `DELETE FROM reservations WHERE wish_id = ? AND reserver_id = ?`
+	res, err := s.db.ExecContext(ctx, query, wishID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
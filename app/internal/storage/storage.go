@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/service"
+	"github.com/eugene-static/wishlist_bot/app/lib/config"
+)
+
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+type Storage interface {
+	service.Storage
+	// Ping checks that the database is reachable.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+func New(ctx context.Context, cfg *config.Storage) (Storage, error) {
+	if cfg.Driver == DriverMemory {
+		return NewMemory(), nil
+	}
+	db, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	migrator, err := NewMigrator(db, cfg.Driver)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err = migrator.Up(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	switch cfg.Driver {
+	case DriverPostgres:
+		return &Postgres{db: db}, nil
+	default:
+		return &SQLite{db: db}, nil
+	}
+}
+
+func Open(cfg *config.Storage) (*sql.DB, error) {
+	switch cfg.Driver {
+	case DriverSQLite:
+		err := os.MkdirAll(path.Dir(cfg.Path), 0750)
+		if err != nil {
+			return nil, err
+		}
+		return sql.Open(cfg.Driver, cfg.Path+"?_foreign_keys=on")
+	case DriverPostgres:
+		return sql.Open(cfg.Driver, cfg.DSN)
+	default:
+		return nil, fmt.Errorf("unsupported storage driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/service"
+	"github.com/eugene-static/wishlist_bot/app/internal/storage/storagetest"
+	"github.com/eugene-static/wishlist_bot/app/lib/config"
+	"github.com/eugene-static/wishlist_bot/app/lib/random"
+)
+
+func TestSQLite(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		return newStorage(t, &config.Storage{Driver: DriverSQLite, Path: filepath.Join(t.TempDir(), "wishlist.sqlite")})
+	})
+}
+
+func TestMemory(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		return NewMemory()
+	})
+}
+
+func TestPostgres(t *testing.T) {
+	dsn := storagetest.PostgresDSN(t)
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		return newStorage(t, &config.Storage{Driver: DriverPostgres, DSN: postgresSchema(t, dsn)})
+	})
+}
+
+// postgresSchema creates an empty schema for the test and returns dsn with
+// it as the search path. Only that schema is dropped when the test ends, the
+// rest of the database is left alone.
+func postgresSchema(t *testing.T, dsn string) string {
+	t.Helper()
+	db, err := Open(&config.Storage{Driver: DriverPostgres, DSN: dsn})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	schema := "wishlist_test_" + strings.ToLower(random.String(16))
+	if _, err = db.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		db.Close()
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("dropping schema: %v", err)
+		}
+		db.Close()
+	})
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("parsing DSN: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func newStorage(t *testing.T, cfg *config.Storage) Storage {
+	t.Helper()
+	s, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
@@ -0,0 +1,400 @@
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/eugene-static/wishlist_bot/app/internal/entity"
+	"github.com/eugene-static/wishlist_bot/app/internal/service"
+)
+
+// Run executes the conformance suite every service.Storage implementation
+// must pass. newStorage is called once per subtest and must return an empty storage.
+func Run(t *testing.T, newStorage func(t *testing.T) service.Storage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s service.Storage)
+	}{
+		{"UserNotFound", testUserNotFound},
+		{"AddAndGetUser", testAddAndGetUser},
+		{"UpdateUser", testUpdateUser},
+		{"EmptyWishlist", testEmptyWishlist},
+		{"Wishlists", testWishlists},
+		{"DeleteWishlist", testDeleteWishlist},
+		{"ShareToken", testShareToken},
+		{"CreateAndGetWishes", testCreateAndGetWishes},
+		{"WishDetails", testWishDetails},
+		{"DuplicateWish", testDuplicateWish},
+		{"DeleteWishes", testDeleteWishes},
+		{"DeleteWishesOwnedOnly", testDeleteWishesOwnedOnly},
+		{"Reservations", testReservations},
+		{"BanAndStats", testBanAndStats},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+func addUser(t *testing.T, s service.Storage, id int64, name string) *entity.User {
+	t.Helper()
+	user := &entity.User{ID: id, Name: name, Password: []byte("secret"), Language: "en"}
+	if err := s.AddUser(context.Background(), user); err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	list := &entity.Wishlist{ID: defaultList(id), UserID: id, Name: "default"}
+	if err := s.CreateWishlist(context.Background(), list); err != nil {
+		t.Fatalf("CreateWishlist: %v", err)
+	}
+	return user
+}
+
+func defaultList(userID int64) string {
+	return fmt.Sprintf("list%d", userID)
+}
+
+func addWishes(t *testing.T, s service.Storage, userID int64, n int) []*entity.Wish {
+	t.Helper()
+	wishes := make([]*entity.Wish, n)
+	for i := range wishes {
+		wishes[i] = &entity.Wish{
+			ID:      fmt.Sprintf("w%d-%d", userID, i),
+			Content: fmt.Sprintf("wish %d", i),
+			ListID:  defaultList(userID),
+			UserID:  userID,
+		}
+		if err := s.CreateWish(context.Background(), wishes[i]); err != nil {
+			t.Fatalf("CreateWish: %v", err)
+		}
+	}
+	return wishes
+}
+
+func getWishes(t *testing.T, s service.Storage, userID int64) []*entity.Wish {
+	t.Helper()
+	list, err := s.GetWishes(context.Background(), defaultList(userID))
+	if err != nil {
+		t.Fatalf("GetWishes: %v", err)
+	}
+	return list
+}
+
+func testUserNotFound(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	if _, err := s.GetUserByID(ctx, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByID: got %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.GetUserByUsername(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByUsername: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testAddAndGetUser(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	want := addUser(t, s, 42, "alice")
+	got, err := s.GetUserByID(ctx, want.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if got.ID != want.ID || got.Name != want.Name || string(got.Password) != string(want.Password) || got.Language != want.Language {
+		t.Errorf("GetUserByID: got %+v, want %+v", got, want)
+	}
+	got, err = s.GetUserByUsername(ctx, want.Name)
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if got.ID != want.ID || string(got.Password) != string(want.Password) || got.Language != want.Language {
+		t.Errorf("GetUserByUsername: got %+v, want %+v", got, want)
+	}
+}
+
+func testUpdateUser(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	user := addUser(t, s, 42, "alice")
+	if err := s.UpdateUsername(ctx, user.ID, "bob"); err != nil {
+		t.Fatalf("UpdateUsername: %v", err)
+	}
+	if err := s.UpdateUserPassword(ctx, user.ID, []byte("new")); err != nil {
+		t.Fatalf("UpdateUserPassword: %v", err)
+	}
+	if err := s.UpdateUserLanguage(ctx, user.ID, "de"); err != nil {
+		t.Fatalf("UpdateUserLanguage: %v", err)
+	}
+	got, err := s.GetUserByUsername(ctx, "bob")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if got.ID != user.ID || string(got.Password) != "new" || got.Language != "de" {
+		t.Errorf("got %+v after update", got)
+	}
+	if _, err = s.GetUserByUsername(ctx, "alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("old username: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testEmptyWishlist(t *testing.T, s service.Storage) {
+	addUser(t, s, 42, "alice")
+	if list := getWishes(t, s, 42); list != nil {
+		t.Errorf("GetWishes: got %v, want nil", list)
+	}
+}
+
+func testWishlists(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	addUser(t, s, 1, "alice")
+	addUser(t, s, 2, "bob")
+	if _, err := s.GetWishlist(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetWishlist: got %v, want sql.ErrNoRows", err)
+	}
+	books := &entity.Wishlist{ID: "books", UserID: 1, Name: "Books", Password: []byte("pass"), Hidden: true}
+	if err := s.CreateWishlist(ctx, books); err != nil {
+		t.Fatalf("CreateWishlist: %v", err)
+	}
+	lists, err := s.GetWishlists(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetWishlists: %v", err)
+	}
+	if len(lists) != 2 || lists[0].ID != defaultList(1) || lists[1].ID != books.ID {
+		t.Fatalf("GetWishlists: got %v, want [%s %s]", lists, defaultList(1), books.ID)
+	}
+	if got := lists[1]; got.Name != books.Name || string(got.Password) != "pass" || !got.Hidden {
+		t.Errorf("GetWishlists: got %+v, want %+v", got, books)
+	}
+	renamed := *books
+	renamed.Name, renamed.Hidden = "Novels", false
+	if err = s.UpdateWishlist(ctx, &renamed); err != nil {
+		t.Fatalf("UpdateWishlist: %v", err)
+	}
+	stolen := renamed
+	stolen.UserID, stolen.Name = 2, "Stolen"
+	if err = s.UpdateWishlist(ctx, &stolen); err != nil {
+		t.Fatalf("UpdateWishlist by another user: %v", err)
+	}
+	got, err := s.GetWishlist(ctx, books.ID)
+	if err != nil {
+		t.Fatalf("GetWishlist: %v", err)
+	}
+	if got.UserID != 1 || got.Name != "Novels" || got.Hidden {
+		t.Errorf("GetWishlist after update: got %+v", got)
+	}
+}
+
+func testShareToken(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	addUser(t, s, 1, "alice")
+	if _, err := s.GetWishlistByToken(ctx, ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetWishlistByToken with empty token: got %v, want sql.ErrNoRows", err)
+	}
+	list, err := s.GetWishlist(ctx, defaultList(1))
+	if err != nil {
+		t.Fatalf("GetWishlist: %v", err)
+	}
+	list.ShareToken = "token"
+	if err = s.UpdateWishlist(ctx, list); err != nil {
+		t.Fatalf("UpdateWishlist: %v", err)
+	}
+	got, err := s.GetWishlistByToken(ctx, "token")
+	if err != nil {
+		t.Fatalf("GetWishlistByToken: %v", err)
+	}
+	if got.ID != list.ID || got.UserID != 1 {
+		t.Errorf("GetWishlistByToken: got %+v, want %+v", got, list)
+	}
+	list.ShareToken = ""
+	if err = s.UpdateWishlist(ctx, list); err != nil {
+		t.Fatalf("UpdateWishlist: %v", err)
+	}
+	if _, err = s.GetWishlistByToken(ctx, "token"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetWishlistByToken after revoke: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testDeleteWishlist(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	addUser(t, s, 1, "alice")
+	addUser(t, s, 2, "bob")
+	addWishes(t, s, 1, 2)
+	if ok, err := s.DeleteWishlist(ctx, 2, defaultList(1)); err != nil || ok {
+		t.Errorf("DeleteWishlist by another user: got %v, %v, want false", ok, err)
+	}
+	if ok, err := s.DeleteWishlist(ctx, 1, defaultList(1)); err != nil || !ok {
+		t.Fatalf("DeleteWishlist: got %v, %v, want true", ok, err)
+	}
+	if _, err := s.GetWishlist(ctx, defaultList(1)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetWishlist after delete: got %v, want sql.ErrNoRows", err)
+	}
+	if list := getWishes(t, s, 1); list != nil {
+		t.Errorf("GetWishes after delete: got %v, want nil", list)
+	}
+}
+
+func testCreateAndGetWishes(t *testing.T, s service.Storage) {
+	addUser(t, s, 1, "alice")
+	addUser(t, s, 2, "bob")
+	want := addWishes(t, s, 1, 5)
+	addWishes(t, s, 2, 2)
+	got := getWishes(t, s, 1)
+	if len(got) != len(want) {
+		t.Fatalf("GetWishes: got %d wishes, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Content != want[i].Content {
+			t.Errorf("wish %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func testWishDetails(t *testing.T, s service.Storage) {
+	addUser(t, s, 1, "alice")
+	want := entity.Wish{
+		ID:       "detailed",
+		Content:  "headphones",
+		Link:     "https://example.com/item",
+		Price:    1299000,
+		Currency: "RUB",
+		Priority: 4,
+		Quantity: 2,
+		Note:     "birthday",
+		ListID:   defaultList(1),
+		UserID:   1,
+	}
+	if err := s.CreateWish(context.Background(), &want); err != nil {
+		t.Fatalf("CreateWish: %v", err)
+	}
+	list := getWishes(t, s, 1)
+	if len(list) != 1 || *list[0] != want {
+		t.Errorf("GetWishes: got %v, want [%+v]", list, want)
+	}
+}
+
+func testDuplicateWish(t *testing.T, s service.Storage) {
+	addUser(t, s, 1, "alice")
+	wish := addWishes(t, s, 1, 1)[0]
+	if err := s.CreateWish(context.Background(), wish); err != nil {
+		t.Fatalf("duplicate CreateWish: got %v, want nil", err)
+	}
+	if list := getWishes(t, s, 1); len(list) != 1 {
+		t.Errorf("GetWishes: got %d wishes, want 1", len(list))
+	}
+}
+
+func testDeleteWishes(t *testing.T, s service.Storage) {
+	addUser(t, s, 1, "alice")
+	wishes := addWishes(t, s, 1, 3)
+	ids := []string{wishes[0].ID, wishes[2].ID, "missing", "'); DROP TABLE wishes; --"}
+	deleted, err := s.DeleteWishes(context.Background(), 1, ids)
+	if err != nil {
+		t.Fatalf("DeleteWishes: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("DeleteWishes: got %d deleted, want 2", deleted)
+	}
+	list := getWishes(t, s, 1)
+	if len(list) != 1 || list[0].ID != wishes[1].ID {
+		t.Errorf("GetWishes after delete: got %v", list)
+	}
+}
+
+func testDeleteWishesOwnedOnly(t *testing.T, s service.Storage) {
+	addUser(t, s, 1, "alice")
+	addUser(t, s, 2, "bob")
+	wishes := addWishes(t, s, 2, 2)
+	deleted, err := s.DeleteWishes(context.Background(), 1, []string{wishes[0].ID, wishes[1].ID})
+	if err != nil {
+		t.Fatalf("DeleteWishes: %v", err)
+	}
+	if deleted != 0 {
+		t.Errorf("DeleteWishes: got %d deleted, want 0", deleted)
+	}
+	if list := getWishes(t, s, 2); len(list) != 2 {
+		t.Errorf("GetWishes of owner: got %d wishes, want 2", len(list))
+	}
+}
+
+func testReservations(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	addUser(t, s, 1, "alice")
+	addUser(t, s, 2, "bob")
+	addUser(t, s, 3, "carol")
+	wishes := addWishes(t, s, 1, 2)
+	if ok, err := s.ReserveWish(ctx, wishes[0].ID, 2); err != nil || !ok {
+		t.Fatalf("ReserveWish: got %v, %v, want true", ok, err)
+	}
+	if ok, err := s.ReserveWish(ctx, wishes[0].ID, 3); err != nil || ok {
+		t.Errorf("ReserveWish of reserved wish: got %v, %v, want false", ok, err)
+	}
+	if ok, err := s.UnreserveWish(ctx, wishes[0].ID, 3); err != nil || ok {
+		t.Errorf("UnreserveWish by another user: got %v, %v, want false", ok, err)
+	}
+	list := getWishes(t, s, 1)
+	if list[0].ReservedBy != 2 || list[1].ReservedBy != 0 {
+		t.Errorf("GetWishes: got reserved by %d and %d, want 2 and 0", list[0].ReservedBy, list[1].ReservedBy)
+	}
+	if ok, err := s.UnreserveWish(ctx, wishes[0].ID, 2); err != nil || !ok {
+		t.Errorf("UnreserveWish: got %v, %v, want true", ok, err)
+	}
+	if ok, err := s.ReserveWish(ctx, wishes[0].ID, 3); err != nil || !ok {
+		t.Errorf("ReserveWish after unreserve: got %v, %v, want true", ok, err)
+	}
+	if _, err := s.DeleteWishes(ctx, 1, []string{wishes[0].ID}); err != nil {
+		t.Fatalf("DeleteWishes: %v", err)
+	}
+	if ok, err := s.UnreserveWish(ctx, wishes[0].ID, 3); err != nil || ok {
+		t.Errorf("UnreserveWish of deleted wish: got %v, %v, want false", ok, err)
+	}
+}
+
+func testBanAndStats(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	addUser(t, s, 1, "alice")
+	addUser(t, s, 2, "bob")
+	addWishes(t, s, 1, 3)
+	if err := s.UpdateUserBanned(ctx, 2, true); err != nil {
+		t.Fatalf("UpdateUserBanned: %v", err)
+	}
+	got, err := s.GetUserByID(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if !got.Banned {
+		t.Errorf("GetUserByID: got not banned user, want banned")
+	}
+	ids, err := s.GetUserIDs(ctx)
+	if err != nil {
+		t.Fatalf("GetUserIDs: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("GetUserIDs: got %v, want [1]", ids)
+	}
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if want := (entity.Stats{Users: 2, Banned: 1, Wishlists: 2, Wishes: 3}); *stats != want {
+		t.Errorf("Stats: got %+v, want %+v", *stats, want)
+	}
+	if err = s.UpdateUserBanned(ctx, 2, false); err != nil {
+		t.Fatalf("UpdateUserBanned: %v", err)
+	}
+	if ids, err = s.GetUserIDs(ctx); err != nil || len(ids) != 2 {
+		t.Errorf("GetUserIDs after unban: got %v, %v, want 2 users", ids, err)
+	}
+}
+
+const postgresDSNEnv = "WISHLIST_TEST_POSTGRES_DSN"
+
+// PostgresDSN returns the DSN of the database used for Postgres conformance
+// runs and skips the test when it is not configured.
+func PostgresDSN(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+	return dsn
+}
@@ -0,0 +1,284 @@
+// Package telegramtest provides an in-process fake of the Telegram Bot API
+// for end-to-end tests of the bot.
+package telegramtest
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	Token    = "123456:test"
+	Username = "wishlist_test_bot"
+	// pollWait is how long getUpdates waits for an update before returning
+	// an empty result.
+	pollWait = 200 * time.Millisecond
+	// maxMessageLength is the limit Telegram puts on the text of a message
+	// once its markup is parsed.
+	maxMessageLength = 4096
+)
+
+var tag = regexp.MustCompile(`<[^>]*>`)
+
+// Message is a message the bot sent or edited.
+type Message struct {
+	Method    string
+	ChatID    int64
+	MessageID int
+	Text      string
+	Markup    *tgbotapi.InlineKeyboardMarkup
+}
+
+// Button returns the callback data of the button labelled text.
+func (m Message) Button(text string) (string, bool) {
+	if m.Markup == nil {
+		return "", false
+	}
+	for _, row := range m.Markup.InlineKeyboard {
+		for _, button := range row {
+			if button.Text == text && button.CallbackData != nil {
+				return *button.CallbackData, true
+			}
+		}
+	}
+	return "", false
+}
+
+type Server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	cond     *sync.Cond
+	updates  []tgbotapi.Update
+	nextID   int
+	messages map[int64][]Message
+	read     map[int64]int
+	answers  map[string]string
+	lastID   map[int64]int
+	language map[int64]string
+}
+
+func NewServer() *Server {
+	s := &Server{
+		messages: make(map[int64][]Message),
+		read:     make(map[int64]int),
+		answers:  make(map[string]string),
+		lastID:   make(map[int64]int),
+		language: make(map[int64]string),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Endpoint is the API endpoint to configure the bot with.
+func (s *Server) Endpoint() string {
+	return s.URL + "/bot%s/%s"
+}
+
+// SetLanguage sets the language code of the Telegram client of the user.
+func (s *Server) SetLanguage(chatID int64, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.language[chatID] = code
+}
+
+// SendText makes the user send a text message to the bot.
+func (s *Server) SendText(chatID int64, username string, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.push(tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: chatID, UserName: username, Type: "private"},
+			From: &tgbotapi.User{ID: chatID, UserName: username, LanguageCode: s.language[chatID]},
+			Date: int(time.Now().Unix()),
+			Text: text,
+		},
+	})
+}
+
+// Press makes the user press the button with callback data on message m.
+// It returns the ID of the callback query.
+func (s *Server) Press(m Message, username string, data string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := strconv.Itoa(s.nextID + 1)
+	s.push(tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:   id,
+			From: &tgbotapi.User{ID: m.ChatID, UserName: username, LanguageCode: s.language[m.ChatID]},
+			Message: &tgbotapi.Message{
+				MessageID: m.MessageID,
+				Chat:      &tgbotapi.Chat{ID: m.ChatID, UserName: username, Type: "private"},
+			},
+			Data: data,
+		},
+	})
+	return id
+}
+
+// push queues an update for getUpdates. It must be called with s.mu held.
+func (s *Server) push(update tgbotapi.Update) {
+	s.nextID++
+	update.UpdateID = s.nextID
+	s.updates = append(s.updates, update)
+	s.cond.Broadcast()
+}
+
+// Next returns the next message the bot sent or edited in the chat, waiting
+// up to timeout for it to appear.
+func (s *Server) Next(chatID int64, timeout time.Duration) (Message, bool) {
+	deadline := time.Now().Add(timeout)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.read[chatID] >= len(s.messages[chatID]) {
+		if !s.wait(deadline) {
+			return Message{}, false
+		}
+	}
+	m := s.messages[chatID][s.read[chatID]]
+	s.read[chatID]++
+	return m, true
+}
+
+// Messages returns everything the bot sent or edited in the chat so far.
+func (s *Server) Messages(chatID int64) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages[chatID]...)
+}
+
+// Answer returns the toast text the callback query was answered with,
+// waiting up to timeout for the answer.
+func (s *Server) Answer(callbackID string, timeout time.Duration) (string, bool) {
+	deadline := time.Now().Add(timeout)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if text, ok := s.answers[callbackID]; ok {
+			return text, true
+		}
+		if !s.wait(deadline) {
+			return "", false
+		}
+	}
+}
+
+// wait blocks until something changes or the deadline passes. It must be
+// called with s.mu held.
+func (s *Server) wait(deadline time.Time) bool {
+	d := time.Until(deadline)
+	if d <= 0 {
+		return false
+	}
+	t := time.AfterFunc(d, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	s.cond.Wait()
+	t.Stop()
+	return true
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		reply(w, nil, err)
+		return
+	}
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	switch method {
+	case "getMe":
+		reply(w, tgbotapi.User{ID: 1, IsBot: true, FirstName: "Wishlist", UserName: Username}, nil)
+	case "getUpdates":
+		offset, _ := strconv.Atoi(r.Form.Get("offset"))
+		reply(w, s.getUpdates(offset), nil)
+	case "sendMessage", "editMessageText":
+		if textLength(r.Form.Get("text")) > maxMessageLength {
+			reply(w, nil, errors.New("Bad Request: message is too long"))
+			return
+		}
+		reply(w, s.record(method, r), nil)
+	case "answerCallbackQuery":
+		s.mu.Lock()
+		s.answers[r.Form.Get("callback_query_id")] = r.Form.Get("text")
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		reply(w, true, nil)
+	default:
+		reply(w, true, nil)
+	}
+}
+
+func (s *Server) getUpdates(offset int) []tgbotapi.Update {
+	deadline := time.Now().Add(pollWait)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		var updates []tgbotapi.Update
+		for _, update := range s.updates {
+			if update.UpdateID >= offset {
+				updates = append(updates, update)
+			}
+		}
+		if len(updates) > 0 || !s.wait(deadline) {
+			return updates
+		}
+	}
+}
+
+func (s *Server) record(method string, r *http.Request) *tgbotapi.Message {
+	chatID, _ := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+	m := Message{
+		Method: method,
+		ChatID: chatID,
+		Text:   r.Form.Get("text"),
+	}
+	if markup := r.Form.Get("reply_markup"); markup != "" {
+		m.Markup = new(tgbotapi.InlineKeyboardMarkup)
+		_ = json.Unmarshal([]byte(markup), m.Markup)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if method == "editMessageText" {
+		m.MessageID, _ = strconv.Atoi(r.Form.Get("message_id"))
+	} else {
+		s.lastID[chatID]++
+		m.MessageID = s.lastID[chatID]
+	}
+	s.messages[chatID] = append(s.messages[chatID], m)
+	s.cond.Broadcast()
+	return &tgbotapi.Message{
+		MessageID: m.MessageID,
+		Chat:      &tgbotapi.Chat{ID: chatID},
+		Date:      int(time.Now().Unix()),
+		Text:      m.Text,
+	}
+}
+
+// textLength returns the length of the message text without its markup.
+func textLength(text string) int {
+	return utf8.RuneCountInString(html.UnescapeString(tag.ReplaceAllString(text, "")))
+}
+
+func reply(w http.ResponseWriter, result any, err error) {
+	resp := map[string]any{"ok": err == nil}
+	if err != nil {
+		resp["error_code"] = http.StatusBadRequest
+		resp["description"] = err.Error()
+	} else {
+		resp["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -2,41 +2,166 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
+)
+
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+const (
+	DefaultPath          = "app/internal/config/config.json"
+	DefaultStorageDriver = "sqlite3"
+	DefaultStoragePath   = "storage/wishlist.sqlite"
+	DefaultSessionDriver = "memory"
+	DefaultUpdateTimeout = 60
+	DefaultWebhookListen = ":8443"
+	DefaultWebhookPath   = "/"
 )
 
 type Config struct {
 	Storage Storage `json:"storage"`
+	Session Session `json:"session"`
 	Logger  Logger  `json:"logger"`
 	Bot     Bot     `json:"bot"`
+	Metrics Metrics `json:"metrics"`
 }
 
 type Storage struct {
 	Driver string `json:"driver"`
 	Path   string `json:"path"`
+	DSN    string `json:"dsn"`
+}
+
+type Session struct {
+	Driver string `json:"driver"`
+	Path   string `json:"path"`
+	TTL    int    `json:"ttl"`
 }
 
 type Logger struct {
-	Env          string `json:"env"`
-	Internal     bool   `json:"internal"`
+	Env string `json:"env"`
+	// Internal logs to stdout instead of the file at ExternalPath. Unset, it
+	// is true when there is no ExternalPath.
+	Internal     *bool  `json:"internal"`
 	ExternalPath string `json:"external_path"`
+	// Tee writes the log to stdout as well as to the file.
+	Tee bool `json:"tee"`
+	// MaxSize in megabytes and MaxAge in hours make the file rotate, Backups
+	// is how many rotated files are kept, 0 keeps them all.
+	MaxSize  int  `json:"max_size"`
+	MaxAge   int  `json:"max_age"`
+	Backups  int  `json:"backups"`
+	Compress bool `json:"compress"`
 }
 
 type Bot struct {
-	Token         string `json:"token"`
-	DebugMode     bool   `json:"debug_mode"`
-	UpdateOffset  int    `json:"update_offset"`
-	UpdateTimeout int    `json:"update_timeout"`
-	UpdateLimit   int    `json:"update_limit"`
+	Token string `json:"token"`
+	// TokenFile is a file holding the token, e.g. a Docker secret. It takes
+	// precedence over Token.
+	TokenFile    string `json:"token_file"`
+	APIEndpoint  string `json:"api_endpoint"`
+	DebugMode    bool   `json:"debug_mode"`
+	Mode         string `json:"mode"`
+	UpdateOffset int    `json:"update_offset"`
+	// UpdateTimeout is how long polling waits for updates in seconds, 0 for
+	// short polling. Unset, it is DefaultUpdateTimeout.
+	UpdateTimeout *int `json:"update_timeout"`
+	UpdateLimit   int  `json:"update_limit"`
+	Workers       int  `json:"workers"`
+	QueueSize     int  `json:"queue_size"`
+	PageSize      int  `json:"page_size"`
+	// Locales is a directory with translation files overriding the built-in texts.
+	Locales string `json:"locales"`
+	// Admins are the Telegram IDs of the users allowed to run admin commands.
+	Admins []int64 `json:"admins"`
+	// Support is the contact users are referred to in error messages, e.g. a username.
+	Support string  `json:"support"`
+	Outbox  Outbox  `json:"outbox"`
+	Webhook Webhook `json:"webhook"`
+}
+
+type Outbox struct {
+	Rate      int `json:"rate"`
+	ChatRate  int `json:"chat_rate"`
+	QueueSize int `json:"queue_size"`
+	Retries   int `json:"retries"`
 }
 
+// Metrics configures the HTTP listener serving /metrics, /healthz and
+// /readyz. It is off when Listen is empty.
+type Metrics struct {
+	Listen string `json:"listen"`
+}
+
+type Webhook struct {
+	URL         string `json:"url"`
+	Listen      string `json:"listen"`
+	Path        string `json:"path"`
+	SecretToken string `json:"secret_token"`
+	CertFile    string `json:"cert_file"`
+	KeyFile     string `json:"key_file"`
+}
+
+// Get reads the config file at path, if path is not empty, then applies the
+// environment overrides (see Env), reads the token file and fills in the
+// defaults. The result still has to be checked with Validate.
 func Get(path string) (*Config, error) {
 	config := &Config{}
-	file, err := os.Open(path)
-	if err != nil {
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if err = json.NewDecoder(file).Decode(config); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", path, err)
+		}
+	}
+	if err := Env(config, EnvPrefix, os.LookupEnv); err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	err = json.NewDecoder(file).Decode(&config)
-	return config, err
+	if config.Bot.TokenFile != "" {
+		token, err := os.ReadFile(config.Bot.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading token file: %w", err)
+		}
+		config.Bot.Token = strings.TrimSpace(string(token))
+	}
+	config.setDefaults()
+	return config, nil
+}
+
+func (c *Config) setDefaults() {
+	if c.Storage.Driver == "" {
+		c.Storage.Driver = DefaultStorageDriver
+	}
+	if c.Storage.Driver == DefaultStorageDriver && c.Storage.Path == "" {
+		c.Storage.Path = DefaultStoragePath
+	}
+	if c.Logger.Internal == nil {
+		internal := c.Logger.ExternalPath == ""
+		c.Logger.Internal = &internal
+	}
+	if c.Session.Driver == "" {
+		c.Session.Driver = DefaultSessionDriver
+	}
+	if c.Bot.Mode == "" {
+		c.Bot.Mode = ModePolling
+	}
+	if c.Bot.UpdateTimeout == nil {
+		timeout := DefaultUpdateTimeout
+		c.Bot.UpdateTimeout = &timeout
+	}
+	if c.Bot.Mode == ModeWebhook {
+		if c.Bot.Webhook.Listen == "" {
+			c.Bot.Webhook.Listen = DefaultWebhookListen
+		}
+		if c.Bot.Webhook.Path == "" {
+			c.Bot.Webhook.Path = DefaultWebhookPath
+		}
+	}
 }
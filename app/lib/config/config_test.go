@@ -0,0 +1,309 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func lookup(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func TestEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]string
+		want Config
+		err  string
+	}{
+		{
+			name: "nothing set",
+		},
+		{
+			name: "fields",
+			vars: map[string]string{
+				"WISHLIST_BOT_TOKEN":          "123:abc",
+				"WISHLIST_BOT_WORKERS":        "4",
+				"WISHLIST_BOT_DEBUG_MODE":     "true",
+				"WISHLIST_BOT_ADMINS":         "1, 2,,3",
+				"WISHLIST_BOT_OUTBOX_RETRIES": "5",
+				"WISHLIST_BOT_WEBHOOK_URL":    "https://example.com/hook",
+				"WISHLIST_STORAGE_DRIVER":     "postgres",
+			},
+			want: Config{
+				Storage: Storage{Driver: "postgres"},
+				Bot: Bot{
+					Token:     "123:abc",
+					Workers:   4,
+					DebugMode: true,
+					Admins:    []int64{1, 2, 3},
+					Outbox:    Outbox{Retries: 5},
+					Webhook:   Webhook{URL: "https://example.com/hook"},
+				},
+			},
+		},
+		{
+			name: "zero pointers",
+			vars: map[string]string{
+				"WISHLIST_BOT_UPDATE_TIMEOUT": "0",
+				"WISHLIST_LOGGER_INTERNAL":    "false",
+			},
+			want: Config{
+				Logger: Logger{Internal: ptr(false)},
+				Bot:    Bot{UpdateTimeout: ptr(0)},
+			},
+		},
+		{
+			name: "invalid values",
+			vars: map[string]string{
+				"WISHLIST_BOT_WORKERS":        "many",
+				"WISHLIST_BOT_UPDATE_TIMEOUT": "long",
+				"WISHLIST_LOGGER_TEE":         "maybe",
+				"WISHLIST_BOT_ADMINS":         "1,root",
+			},
+			want: Config{Bot: Bot{Admins: []int64{1}}},
+			err:  `WISHLIST_LOGGER_TEE: "maybe" is not a boolean`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Config
+			err := Env(&c, EnvPrefix, lookup(tt.vars))
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("Env() error = %v, want %q", err, tt.err)
+			}
+			if !reflect.DeepEqual(c, tt.want) {
+				t.Errorf("Env() = %+v, want %+v", c, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvReportsEveryError(t *testing.T) {
+	var c Config
+	err := Env(&c, EnvPrefix, lookup(map[string]string{
+		"WISHLIST_BOT_WORKERS":        "many",
+		"WISHLIST_BOT_UPDATE_TIMEOUT": "long",
+		"WISHLIST_BOT_ADMINS":         "root",
+	}))
+	if err == nil {
+		t.Fatal("Env() error = nil")
+	}
+	for _, name := range []string{"WISHLIST_BOT_WORKERS", "WISHLIST_BOT_UPDATE_TIMEOUT", "WISHLIST_BOT_ADMINS"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Env() error %q does not mention %s", err, name)
+		}
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Config
+		want Config
+	}{
+		{
+			name: "empty",
+			want: Config{
+				Storage: Storage{Driver: DefaultStorageDriver, Path: DefaultStoragePath},
+				Session: Session{Driver: DefaultSessionDriver},
+				Logger:  Logger{Internal: ptr(true)},
+				Bot:     Bot{Mode: ModePolling, UpdateTimeout: ptr(DefaultUpdateTimeout)},
+			},
+		},
+		{
+			name: "explicit values",
+			c: Config{
+				Storage: Storage{Driver: "postgres", DSN: "postgres://db"},
+				Session: Session{Driver: "sqlite3", Path: "sessions.sqlite"},
+				Logger:  Logger{Internal: ptr(false)},
+				Bot:     Bot{Mode: ModePolling, UpdateTimeout: ptr(0)},
+			},
+			want: Config{
+				Storage: Storage{Driver: "postgres", DSN: "postgres://db"},
+				Session: Session{Driver: "sqlite3", Path: "sessions.sqlite"},
+				Logger:  Logger{Internal: ptr(false)},
+				Bot:     Bot{Mode: ModePolling, UpdateTimeout: ptr(0)},
+			},
+		},
+		{
+			name: "log file",
+			c:    Config{Logger: Logger{ExternalPath: "bot.log"}},
+			want: Config{
+				Storage: Storage{Driver: DefaultStorageDriver, Path: DefaultStoragePath},
+				Session: Session{Driver: DefaultSessionDriver},
+				Logger:  Logger{Internal: ptr(false), ExternalPath: "bot.log"},
+				Bot:     Bot{Mode: ModePolling, UpdateTimeout: ptr(DefaultUpdateTimeout)},
+			},
+		},
+		{
+			name: "webhook",
+			c:    Config{Bot: Bot{Mode: ModeWebhook}},
+			want: Config{
+				Storage: Storage{Driver: DefaultStorageDriver, Path: DefaultStoragePath},
+				Session: Session{Driver: DefaultSessionDriver},
+				Logger:  Logger{Internal: ptr(true)},
+				Bot: Bot{
+					Mode:          ModeWebhook,
+					UpdateTimeout: ptr(DefaultUpdateTimeout),
+					Webhook:       Webhook{Listen: DefaultWebhookListen, Path: DefaultWebhookPath},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.c.setDefaults()
+			if !reflect.DeepEqual(tt.c, tt.want) {
+				t.Errorf("setDefaults() = %+v, want %+v", tt.c, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		c := Config{Bot: Bot{Token: "123:abc"}}
+		c.setDefaults()
+		return c
+	}
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		errs   []string
+	}{
+		{
+			name:   "defaults",
+			change: func(c *Config) {},
+		},
+		{
+			name:   "no token",
+			change: func(c *Config) { c.Bot.Token = "" },
+			errs:   []string{"bot.token is not set"},
+		},
+		{
+			name:   "log file without path",
+			change: func(c *Config) { c.Logger.Internal = ptr(false) },
+			errs:   []string{"logger.external_path is not set"},
+		},
+		{
+			name:   "short polling",
+			change: func(c *Config) { c.Bot.UpdateTimeout = ptr(0) },
+		},
+		{
+			name: "drivers",
+			change: func(c *Config) {
+				c.Storage = Storage{Driver: "mysql"}
+				c.Session = Session{Driver: "sqlite3"}
+			},
+			errs: []string{`storage.driver "mysql" is not supported`, "session.path is not set"},
+		},
+		{
+			name:   "postgres",
+			change: func(c *Config) { c.Storage = Storage{Driver: "postgres"} },
+			errs:   []string{"storage.dsn is not set"},
+		},
+		{
+			name: "webhook",
+			change: func(c *Config) {
+				c.Bot.Mode = ModeWebhook
+				c.Bot.Webhook.CertFile = "cert.pem"
+			},
+			errs: []string{"bot.webhook.url is not set", "cert_file and bot.webhook.key_file must be set together"},
+		},
+		{
+			name: "numbers",
+			change: func(c *Config) {
+				c.Bot.UpdateTimeout = ptr(-1)
+				c.Bot.Outbox.Rate = -1
+				c.Bot.UpdateLimit = 101
+				c.Bot.Admins = []int64{0}
+				c.Session.TTL = -1
+			},
+			errs: []string{
+				"bot.update_timeout must not be negative",
+				"bot.outbox.rate must not be negative",
+				"bot.update_limit must be at most 100",
+				"bot.admins: 0 is not a user ID",
+				"session.ttl must not be negative",
+			},
+		},
+		{
+			name:   "unknown mode",
+			change: func(c *Config) { c.Bot.Mode = "push" },
+			errs:   []string{`bot.mode "push" is not supported`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.change(&c)
+			err := c.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want %q", tt.errs)
+			}
+			if n := len(strings.Split(err.Error(), "\n")); n != len(tt.errs) {
+				t.Errorf("Validate() reported %d errors, want %d: %v", n, len(tt.errs), err)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	file := `{"bot": {"token": "from file", "update_timeout": 0, "page_size": 5}, "logger": {"external_path": "bot.log"}}`
+	if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WISHLIST_BOT_PAGE_SIZE", "7")
+	c, err := Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Bot.Token != "from file" || c.Bot.PageSize != 7 {
+		t.Errorf("Get() bot = %+v, want the token from the file and the page size from the environment", c.Bot)
+	}
+	if c.Bot.UpdateTimeout == nil || *c.Bot.UpdateTimeout != 0 {
+		t.Errorf("Get() update timeout = %v, want 0", c.Bot.UpdateTimeout)
+	}
+	if c.Logger.Internal == nil || *c.Logger.Internal {
+		t.Errorf("Get() logger internal = %v, want false", c.Logger.Internal)
+	}
+}
+
+// TestGetEnvOnly checks that a config taken from the environment alone is
+// valid with just the token set.
+func TestGetEnvOnly(t *testing.T) {
+	t.Setenv("WISHLIST_BOT_TOKEN", "123:abc")
+	c, err := Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if !*c.Logger.Internal || *c.Bot.UpdateTimeout != DefaultUpdateTimeout {
+		t.Errorf("Get() logger = %+v, bot = %+v, want the defaults", c.Logger, c.Bot)
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the names of the environment variables overriding the
+// config, e.g. WISHLIST_BOT_TOKEN or WISHLIST_STORAGE_PATH.
+const EnvPrefix = "WISHLIST"
+
+// Env overrides every field of config with the variable named after the
+// path of its json keys, upper-cased and joined with "_" after prefix.
+// Lists are separated by commas. lookup is usually os.LookupEnv.
+func Env(config *Config, prefix string, lookup func(string) (string, bool)) error {
+	return env(reflect.ValueOf(config).Elem(), prefix, lookup)
+}
+
+func env(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	var errs []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			errs = append(errs, env(field, name, lookup))
+			continue
+		}
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		errs = append(errs, set(field, name, value))
+	}
+	return errors.Join(errs...)
+}
+
+// set parses value into field. Pointer fields get a value allocated, so that
+// a variable set to zero differs from an unset one.
+func set(field reflect.Value, name string, value string) error {
+	switch field.Kind() {
+	case reflect.Pointer:
+		p := reflect.New(field.Type().Elem())
+		if err := set(p.Elem(), name, value); err != nil {
+			return err
+		}
+		field.Set(p)
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", name, value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", name, value)
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Int64 {
+			return nil
+		}
+		var (
+			ids  []int64
+			errs []error
+		)
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a number", name, s))
+				continue
+			}
+			ids = append(ids, n)
+		}
+		field.Set(reflect.ValueOf(ids))
+		return errors.Join(errs...)
+	}
+	return nil
+}
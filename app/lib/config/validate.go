@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(c.Bot.Token != "", "bot.token is not set")
+	switch c.Storage.Driver {
+	case "sqlite3":
+		check(c.Storage.Path != "", "storage.path is not set")
+	case "postgres":
+		check(c.Storage.DSN != "", "storage.dsn is not set")
+	case "memory":
+	default:
+		check(false, "storage.driver %q is not supported", c.Storage.Driver)
+	}
+	switch c.Session.Driver {
+	case "sqlite3":
+		check(c.Session.Path != "", "session.path is not set")
+	case "memory":
+	default:
+		check(false, "session.driver %q is not supported", c.Session.Driver)
+	}
+	check(c.Session.TTL >= 0, "session.ttl must not be negative")
+	check(c.Logger.Internal == nil || *c.Logger.Internal || c.Logger.ExternalPath != "", "logger.external_path is not set")
+	switch c.Bot.Mode {
+	case ModePolling:
+	case ModeWebhook:
+		check(c.Bot.Webhook.URL != "", "bot.webhook.url is not set")
+		check((c.Bot.Webhook.CertFile == "") == (c.Bot.Webhook.KeyFile == ""),
+			"bot.webhook.cert_file and bot.webhook.key_file must be set together")
+	default:
+		check(false, "bot.mode %q is not supported", c.Bot.Mode)
+	}
+	for _, field := range []struct {
+		name  string
+		value int
+	}{
+		{"logger.max_size", c.Logger.MaxSize},
+		{"logger.max_age", c.Logger.MaxAge},
+		{"logger.backups", c.Logger.Backups},
+		{"bot.update_offset", c.Bot.UpdateOffset},
+		{"bot.update_timeout", value(c.Bot.UpdateTimeout)},
+		{"bot.update_limit", c.Bot.UpdateLimit},
+		{"bot.workers", c.Bot.Workers},
+		{"bot.queue_size", c.Bot.QueueSize},
+		{"bot.page_size", c.Bot.PageSize},
+		{"bot.outbox.rate", c.Bot.Outbox.Rate},
+		{"bot.outbox.chat_rate", c.Bot.Outbox.ChatRate},
+		{"bot.outbox.queue_size", c.Bot.Outbox.QueueSize},
+		{"bot.outbox.retries", c.Bot.Outbox.Retries},
+	} {
+		check(field.value >= 0, "%s must not be negative", field.name)
+	}
+	for _, id := range c.Bot.Admins {
+		check(id > 0, "bot.admins: %d is not a user ID", id)
+	}
+	check(c.Bot.UpdateLimit <= 100, "bot.update_limit must be at most 100")
+	return errors.Join(errs...)
+}
+
+// value returns the number p points to, 0 when p is nil.
+func value(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
@@ -12,6 +12,8 @@ const (
 	Code          = "code"
 )
 
+// Format wraps text into the tag of style. text must already be escaped, see
+// Style for composing escaped parts.
 func Format(text string, style string) string {
 	switch style {
 	case Bold:
@@ -26,8 +28,8 @@ func Format(text string, style string) string {
 		text = fmt.Sprintf("<span class=\"tg-spoiler\">%s</span>", text)
 	case Monotype:
 		text = fmt.Sprintf("<code>%s</code>", text)
-		//case Code:
-		//	text = fmt.Sprintf("```%s```", text)
+	case Code:
+		text = fmt.Sprintf("<pre>%s</pre>", text)
 	}
 	return text
 }
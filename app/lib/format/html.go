@@ -0,0 +1,96 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// HTML is message text that is safe to send in the HTML parse mode.
+type HTML string
+
+// Len returns the length of h in characters. Markup is counted too, so it
+// is an upper bound of the length Telegram checks against its limits.
+func (h HTML) Len() int {
+	return utf8.RuneCountInString(string(h))
+}
+
+// Escape makes s safe to put into a message sent in the HTML parse mode.
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// Text is a text node, special characters in s are escaped.
+func Text(s string) HTML {
+	return HTML(Escape(s))
+}
+
+// Raw trusts s to already be valid message markup.
+func Raw(s string) HTML {
+	return HTML(s)
+}
+
+func Join(parts ...HTML) HTML {
+	var b Builder
+	return b.Add(parts...).HTML()
+}
+
+// Style wraps parts into the tag of style, see Format.
+func Style(style string, parts ...HTML) HTML {
+	return HTML(Format(string(Join(parts...)), style))
+}
+
+func Link(url string, parts ...HTML) HTML {
+	return HTML("<a href=\"" + Escape(url) + "\">" + string(Join(parts...)) + "</a>")
+}
+
+// Builder composes a message out of parts.
+type Builder struct {
+	b strings.Builder
+}
+
+func (b *Builder) Add(parts ...HTML) *Builder {
+	for _, part := range parts {
+		b.b.WriteString(string(part))
+	}
+	return b
+}
+
+// Text adds s as a text node.
+func (b *Builder) Text(s string) *Builder {
+	return b.Add(Text(s))
+}
+
+func (b *Builder) Bold(parts ...HTML) *Builder {
+	return b.Add(Style(Bold, parts...))
+}
+
+func (b *Builder) Italic(parts ...HTML) *Builder {
+	return b.Add(Style(Italic, parts...))
+}
+
+func (b *Builder) Code(parts ...HTML) *Builder {
+	return b.Add(Style(Monotype, parts...))
+}
+
+func (b *Builder) Spoiler(parts ...HTML) *Builder {
+	return b.Add(Style(Spoiler, parts...))
+}
+
+func (b *Builder) Link(url string, parts ...HTML) *Builder {
+	return b.Add(Link(url, parts...))
+}
+
+// Len returns the length of the message in characters, see HTML.Len.
+func (b *Builder) Len() int {
+	return b.HTML().Len()
+}
+
+func (b *Builder) HTML() HTML {
+	return HTML(b.b.String())
+}
+
+func (b *Builder) String() string {
+	return b.b.String()
+}
@@ -0,0 +1,76 @@
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var currencySymbols = map[string]string{
+	"RUB": "₽",
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"KZT": "₸",
+	"UAH": "₴",
+	"TRY": "₺",
+	"GEL": "₾",
+	"AMD": "֏",
+	"CNY": "¥",
+	"BYN": "Br",
+}
+
+var currencyAliases = map[string]string{
+	"₽":    "RUB",
+	"р":    "RUB",
+	"р.":   "RUB",
+	"руб":  "RUB",
+	"руб.": "RUB",
+	"$":    "USD",
+	"€":    "EUR",
+	"£":    "GBP",
+	"₸":    "KZT",
+	"₴":    "UAH",
+	"₺":    "TRY",
+	"₾":    "GEL",
+	"֏":    "AMD",
+	"¥":    "CNY",
+}
+
+// Currency returns the ISO 4217 code for a currency code, symbol or common
+// abbreviation, or an empty string if it is not recognised.
+func Currency(s string) string {
+	if code, ok := currencyAliases[strings.ToLower(s)]; ok {
+		return code
+	}
+	code := strings.ToUpper(s)
+	if _, ok := currencySymbols[code]; ok {
+		return code
+	}
+	return ""
+}
+
+// Price renders an amount given in minor units (hundredths) with thousands
+// separated by spaces and the currency symbol where one is known.
+func Price(amount int64, currency string) string {
+	units, cents := amount/100, amount%100
+	digits := strconv.FormatInt(units, 10)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(" ")
+		}
+		b.WriteRune(d)
+	}
+	if cents != 0 {
+		b.WriteString(fmt.Sprintf(",%02d", cents))
+	}
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	if symbol != "" {
+		b.WriteString(" " + symbol)
+	}
+	return b.String()
+}
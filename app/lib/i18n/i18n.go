@@ -0,0 +1,196 @@
+// Package i18n keeps the texts of the bot in several languages.
+//
+// Translations are JSON files named after the language, e.g. en.json, mapping
+// text keys either to a string or to plural forms:
+//
+//	{
+//	  "textGreetings": "So, what shall we do?",
+//	  "textWishCount": {"one": "{n} wish", "other": "{n} wishes"}
+//	}
+//
+// Texts may contain {name} placeholders filled in from Args. A text missing in
+// a language is taken from the fallback language.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	One   = "one"
+	Few   = "few"
+	Many  = "many"
+	Other = "other"
+)
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// Args are the values of the placeholders of a text.
+type Args map[string]any
+
+// Message is a translated text with its plural forms. Other is used for
+// texts without plural forms.
+type Message map[string]string
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*m = Message{Other: text}
+		return nil
+	}
+	var forms map[string]string
+	if err := json.Unmarshal(data, &forms); err != nil {
+		return err
+	}
+	*m = forms
+	return nil
+}
+
+type Catalog struct {
+	mu       sync.RWMutex
+	fallback string
+	messages map[string]map[string]Message
+}
+
+func New(fallback string) *Catalog {
+	return &Catalog{
+		fallback: fallback,
+		messages: make(map[string]map[string]Message),
+	}
+}
+
+// Load adds the translations from every *.json file in the root of fsys.
+// Texts already in the catalog are replaced.
+func (c *Catalog) Load(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		var messages map[string]Message
+		if err = json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("error parsing %s: %w", file, err)
+		}
+		c.Add(strings.TrimSuffix(path.Base(file), ".json"), messages)
+	}
+	return nil
+}
+
+func (c *Catalog) Add(lang string, messages map[string]Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.messages[lang] == nil {
+		c.messages[lang] = make(map[string]Message, len(messages))
+	}
+	for key, m := range messages {
+		c.messages[lang][key] = m
+	}
+}
+
+func (c *Catalog) Languages() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	langs := make([]string, 0, len(c.messages))
+	for lang := range c.messages {
+		langs = append(langs, lang)
+	}
+	slices.Sort(langs)
+	return langs
+}
+
+// Match returns the language of the catalog for a Telegram language code
+// like "en" or "pt-br", falling back to the default language.
+func (c *Catalog) Match(code string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	code = strings.ToLower(code)
+	for code != "" {
+		if _, ok := c.messages[code]; ok {
+			return code
+		}
+		i := strings.LastIndexAny(code, "-_")
+		if i < 0 {
+			break
+		}
+		code = code[:i]
+	}
+	return c.fallback
+}
+
+// Text returns the text under key in lang with the placeholders filled in.
+// The key itself is returned for a text missing in every language.
+func (c *Catalog) Text(lang string, key string, args Args) string {
+	return c.render(lang, key, func(string) string { return Other }, args)
+}
+
+// Plural returns the form of the text under key matching n, which is
+// available to it as the {n} placeholder.
+func (c *Catalog) Plural(lang string, key string, n int, args Args) string {
+	if args == nil {
+		args = Args{}
+	}
+	args["n"] = n
+	return c.render(lang, key, func(lang string) string { return PluralForm(lang, n) }, args)
+}
+
+// render fills in the text under key in the form chosen by the plural rules
+// of the language the text is found in.
+func (c *Catalog) render(lang string, key string, form func(lang string) string, args Args) string {
+	c.mu.RLock()
+	m, ok := c.messages[lang][key]
+	if !ok {
+		lang = c.fallback
+		m, ok = c.messages[lang][key]
+	}
+	c.mu.RUnlock()
+	if !ok {
+		return key
+	}
+	text, ok := m[form(lang)]
+	if !ok {
+		text = m[Other]
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return placeholder.ReplaceAllStringFunc(text, func(s string) string {
+		if v, ok := args[s[1:len(s)-1]]; ok {
+			return fmt.Sprint(v)
+		}
+		return s
+	})
+}
+
+// PluralForm returns the CLDR plural category of n in lang.
+func PluralForm(lang string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	switch lang {
+	case "ru", "uk", "be":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return One
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return Few
+		default:
+			return Many
+		}
+	default:
+		if n == 1 {
+			return One
+		}
+		return Other
+	}
+}
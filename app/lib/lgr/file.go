@@ -0,0 +1,239 @@
+package lgr
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	backupTimeFormat = "20060102-150405.000"
+	compressSuffix   = ".gz"
+)
+
+type FileOptions struct {
+	// MaxSize is the size in bytes the file is rotated at, 0 for no limit.
+	MaxSize int64
+	// MaxAge is how long the file is written to before rotating, 0 for no limit.
+	MaxAge time.Duration
+	// Backups is how many rotated files are kept, 0 keeps them all.
+	Backups int
+	// Compress makes rotated files gzipped.
+	Compress bool
+}
+
+// File is a log file rotated by size and age. Rotated files are renamed to
+// the path with a timestamp appended and the oldest beyond the retention
+// count are removed.
+type File struct {
+	opts     FileOptions
+	path     string
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+	// compressing tracks rotated files being gzipped in the background.
+	compressing sync.WaitGroup
+	// backups is held while rotated files are compressed or pruned, so that
+	// pruning never sees a file half compressed.
+	backups sync.Mutex
+}
+
+// OpenFile opens the log file at path for appending, creating it and its
+// directory if needed.
+func OpenFile(path string, opts FileOptions) (*File, error) {
+	f := &File{opts: opts, path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	if f.size > 0 {
+		f.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	// A failed rotation leaves no file open, try again.
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.due(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due reports whether writing n more bytes needs the file rotated first.
+func (f *File) due(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+n > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.MaxAge > 0 && time.Since(f.openedAt) >= f.opts.MaxAge
+}
+
+// Rotate starts a new file right away.
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file == nil {
+		return f.open()
+	}
+	return f.rotate()
+}
+
+func (f *File) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return err
+	}
+	backup := f.path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		_ = f.open()
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	if f.opts.Compress {
+		f.compressing.Add(1)
+		go func() {
+			defer f.compressing.Done()
+			f.backups.Lock()
+			defer f.backups.Unlock()
+			if err := compress(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "error compressing log file %s: %v\n", backup, err)
+			}
+			f.prune()
+		}()
+		return nil
+	}
+	f.backups.Lock()
+	defer f.backups.Unlock()
+	f.prune()
+	return nil
+}
+
+// Reopen closes the file and opens the file at the path again, which picks
+// up a file moved away by an external tool such as logrotate.
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file != nil {
+		err := f.file.Close()
+		f.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	return f.open()
+}
+
+// Close closes the file once the rotated files are compressed.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.compressing.Wait()
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// prune removes the oldest rotated files beyond the retention count. A file
+// left both plain and compressed by a failed compression counts once.
+func (f *File) prune() {
+	if f.opts.Backups <= 0 {
+		return
+	}
+	files, err := filepath.Glob(f.path + ".[0-9]*")
+	if err != nil {
+		return
+	}
+	backups := make([]string, len(files))
+	for i, file := range files {
+		backups[i] = strings.TrimSuffix(file, compressSuffix)
+	}
+	// The timestamps sort in the order the files were rotated in.
+	slices.Sort(backups)
+	backups = slices.Compact(backups)
+	slices.Reverse(backups)
+	for _, backup := range backups[min(f.opts.Backups, len(backups)):] {
+		_ = os.Remove(backup)
+		_ = os.Remove(backup + compressSuffix)
+	}
+}
+
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+compressSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,201 @@
+package lgr
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backupTick keeps rotations apart, as backups are named by the millisecond.
+const backupTick = 2 * time.Millisecond
+
+func openFile(t *testing.T, opts FileOptions) (*File, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "logs", "bot.log")
+	f, err := OpenFile(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f, path
+}
+
+func write(t *testing.T, f *File, s string) {
+	t.Helper()
+	if _, err := io.WriteString(f, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rotate(t *testing.T, f *File) {
+	t.Helper()
+	time.Sleep(backupTick)
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// backups returns the rotated files next to path, oldest first.
+func backups(t *testing.T, path string) []string {
+	t.Helper()
+	files, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(path, compressSuffix) {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileRotatesBySize(t *testing.T) {
+	f, path := openFile(t, FileOptions{MaxSize: 10})
+	write(t, f, "first\n")
+	write(t, f, "second\n")
+	time.Sleep(backupTick)
+	write(t, f, "third\n")
+	files := backups(t, path)
+	if len(files) != 2 {
+		t.Fatalf("got backups %v, want 2", files)
+	}
+	if got := read(t, files[0]); got != "first\n" {
+		t.Errorf("first backup = %q", got)
+	}
+	if got := read(t, files[1]); got != "second\n" {
+		t.Errorf("second backup = %q", got)
+	}
+	if got := read(t, path); got != "third\n" {
+		t.Errorf("log file = %q", got)
+	}
+}
+
+func TestFileRotatesByAge(t *testing.T) {
+	f, path := openFile(t, FileOptions{MaxAge: 50 * time.Millisecond})
+	write(t, f, "old\n")
+	write(t, f, "still old\n")
+	time.Sleep(60 * time.Millisecond)
+	write(t, f, "new\n")
+	files := backups(t, path)
+	if len(files) != 1 {
+		t.Fatalf("got backups %v, want 1", files)
+	}
+	if got := read(t, files[0]); got != "old\nstill old\n" {
+		t.Errorf("backup = %q", got)
+	}
+	if got := read(t, path); got != "new\n" {
+		t.Errorf("log file = %q", got)
+	}
+}
+
+func TestFileKeepsBackups(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "plain"
+		if compress {
+			name = "compressed"
+		}
+		t.Run(name, func(t *testing.T) {
+			f, path := openFile(t, FileOptions{Backups: 2, Compress: compress})
+			for _, s := range []string{"1", "2", "3", "4", "5"} {
+				write(t, f, s)
+				rotate(t, f)
+			}
+			// Close waits for the compression to finish.
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			files := backups(t, path)
+			if len(files) != 2 {
+				t.Fatalf("got backups %v, want 2", files)
+			}
+			for i, want := range []string{"4", "5"} {
+				if compress != strings.HasSuffix(files[i], compressSuffix) {
+					t.Errorf("backup %s, want compressed %v", files[i], compress)
+				}
+				if got := read(t, files[i]); got != want {
+					t.Errorf("backup %s = %q, want %q", files[i], got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestFilePrunesHalfCompressed checks that a backup left both plain and
+// compressed counts as one.
+func TestFilePrunesHalfCompressed(t *testing.T) {
+	f, path := openFile(t, FileOptions{Backups: 2})
+	write(t, f, "1")
+	rotate(t, f)
+	stale := backups(t, path)[0]
+	if err := os.WriteFile(stale+compressSuffix, nil, 0640); err != nil {
+		t.Fatal(err)
+	}
+	write(t, f, "2")
+	rotate(t, f)
+	if files := backups(t, path); len(files) != 3 {
+		t.Fatalf("got backups %v, want 3", files)
+	}
+	write(t, f, "3")
+	rotate(t, f)
+	files := backups(t, path)
+	if len(files) != 2 || read(t, files[0]) != "2" || read(t, files[1]) != "3" {
+		t.Fatalf("got backups %v, want the last 2", files)
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	f, path := openFile(t, FileOptions{})
+	write(t, f, "before\n")
+	moved := path + ".moved"
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	write(t, f, "still before\n")
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	write(t, f, "after\n")
+	if got := read(t, moved); got != "before\nstill before\n" {
+		t.Errorf("moved file = %q", got)
+	}
+	if got := read(t, path); got != "after\n" {
+		t.Errorf("log file = %q", got)
+	}
+}
+
+func TestFileClosed(t *testing.T) {
+	f, _ := openFile(t, FileOptions{})
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("late\n")); err != os.ErrClosed {
+		t.Errorf("Write() error = %v, want %v", err, os.ErrClosed)
+	}
+	if err := f.Reopen(); err != os.ErrClosed {
+		t.Errorf("Reopen() error = %v, want %v", err, os.ErrClosed)
+	}
+}
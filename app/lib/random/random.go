@@ -1,17 +1,29 @@
 package random
 
 import (
+	crand "crypto/rand"
 	"math/rand"
-	"time"
 )
 
-var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
-
 func String(length int) string {
 	var charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 	b := make([]byte, length)
 	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset)-1)]
+		b[i] = charset[rand.Intn(len(charset))]
+	}
+	return string(b)
+}
+
+// Token returns a URL-safe string from a cryptographically secure source,
+// suitable for secrets such as share links.
+func Token(length int) string {
+	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, length)
+	if _, err := crand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = charset[int(b[i])%len(charset)]
 	}
 	return string(b)
 }